@@ -3,9 +3,10 @@ import { axiosClient } from './axios'
 export interface LastMessage {
     id: string
     content: string
+    preview?: string
     created_at: string
     group_id: string
-    sender_id: string
+    sender_id: string | null
     sender_name: string
     type: string
 }
@@ -7,8 +7,9 @@ export interface Message {
     created_at: string
     group_id: string
     id: string
-    sender_id: string
+    sender_id: string | null
     type: string
+    payload?: Record<string, any>
     status?: string
 }
 
@@ -22,7 +22,7 @@ export function ChatWindow() {
             const msg = (e as any).detail
             // TODO: If the message received was sent by this user, use it as an ack, or for updating chat state when used cross device
             
-            if (msg.type === "text_message" && msg.payload?.group_id === selectedGroupId) {
+            if ((msg.type === "text_message" || msg.type === "system_message") && msg.payload?.group_id === selectedGroupId) {
                 const payload = msg.payload
                 if(payload.sender_id === currentUserId) {
                     return
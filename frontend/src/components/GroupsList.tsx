@@ -25,9 +25,9 @@ function Group({ group, selected }: { group: Group, selected: boolean }) {
                     {group.last_message ? formatMessageTime(group.last_message.created_at) : <></>}
                 </p>
             </div>
-            {group.last_message && group.last_message.type === "text" ?
+            {group.last_message ?
                 <p className="text-base text-gray-600">
-                    {group.last_message.sender_id === currentUserId ? "You" : group.last_message.sender_name}: {group.last_message.content}
+                    {group.last_message.sender_id === null ? "" : `${group.last_message.sender_id === currentUserId ? "You" : group.last_message.sender_name}: `}{group.last_message.preview ?? group.last_message.content}
                 </p>
                 : <p className="text-base text-gray-500">No messages yet</p>}
         </div>
@@ -47,7 +47,7 @@ export function GroupsList() {
     useEffect(() => {
         const handleWSMessage = (e: Event) => {
             const msg = (e as any).detail
-            if (msg.type === "text_message" && msg.payload?.group_id) {
+            if ((msg.type === "text_message" || msg.type === "system_message") && msg.payload?.group_id) {
                 queryClient.setQueryData<GroupResult>(
                     ["groups"],
                     (old) => {
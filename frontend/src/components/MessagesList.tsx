@@ -22,8 +22,31 @@ const queryFn = async ({ pageParam }: { pageParam?: PaginationParams }) => {
 }
 
 
+// Renders the change to the group recorded by a system message, the actor_id of the payload made the change
+function systemMessageText(message: Message, memberMap?: Record<string, GroupMember>) {
+    const nameOf = (id: string) => memberMap?.[id]?.name || id
+    const payload = message.payload || {}
+    const sender = nameOf(payload.actor_id)
+    switch (payload.event) {
+        case "member_joined":
+            return `${sender} joined the group`
+        case "member_left":
+            return `${sender} left the group`
+        case "member_removed":
+            return `${sender} removed ${nameOf(payload.user_id)} from the group`
+        case "group_renamed":
+            return `${sender} renamed the group to ${payload.name}`
+        case "description_changed":
+            return `${sender} changed the description of the group`
+    }
+    return `${sender} updated the group`
+}
+
 function ChatMessage({ message, memberMap }: { message: Message, memberMap?: Record<string, GroupMember> }) {
     const currentUserId = useChatStore((state) => state.currentUserId)
+    if (message.type === "system") {
+        return <div className="self-center"><SystemMessage text={systemMessageText(message, memberMap)} /></div>
+    }
     // TODO: Check if it's empty
     let senderIsCurrentUser = false
     if (currentUserId === message.sender_id) {
@@ -34,8 +57,9 @@ function ChatMessage({ message, memberMap }: { message: Message, memberMap?: Rec
     const isSent = (!message.status) || message.status === "sent"
     const isError = message.status === "error"
 
-    const senderName = memberMap?.[message.sender_id]?.name || message.sender_id;
-    const username = memberMap?.[message.sender_id]?.username || message.sender_id;
+    const senderId = message.sender_id ?? ""
+    const senderName = memberMap?.[senderId]?.name || senderId;
+    const username = memberMap?.[senderId]?.username || senderId;
 
     // TODO: Later map message sender id to username
     return <div className={`p-3 ${senderIsCurrentUser ? "bg-green-100 self-end" : "bg-slate-100"} mb-2 rounded-lg w-fit lg:max-w-6/12 md:max-w-8/12 sm:max-w-10/12 max-w-11/12 shadow-sm`}>
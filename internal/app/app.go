@@ -4,26 +4,30 @@ import (
 	"context"
 	"time"
 
+	"github.com/ananthvk/gochat/internal/attachment"
 	"github.com/ananthvk/gochat/internal/auth"
 	"github.com/ananthvk/gochat/internal/config"
 	"github.com/ananthvk/gochat/internal/database"
 	"github.com/ananthvk/gochat/internal/group"
+	"github.com/ananthvk/gochat/internal/invite"
 	"github.com/ananthvk/gochat/internal/message"
 	"github.com/ananthvk/gochat/internal/realtime"
 	"github.com/ananthvk/gochat/internal/token"
 )
 
 type App struct {
-	Ctx             context.Context
-	RealtimeService *realtime.RealtimeService
-	DatabaseService *database.DatabaseService
-	GroupService    *group.GroupService
-	MessageService  *message.MessageService
-	AuthService     *auth.AuthService
-	TokenService    *token.TokenService
-	Config          *config.Config
-	Version         string
-	StartTime       time.Time
+	Ctx               context.Context
+	RealtimeService   *realtime.RealtimeService
+	DatabaseService   *database.DatabaseService
+	GroupService      *group.GroupService
+	InviteService     *invite.InviteService
+	MessageService    *message.MessageService
+	AttachmentService *attachment.AttachmentService
+	AuthService       *auth.AuthService
+	TokenService      *token.TokenService
+	Config            *config.Config
+	Version           string
+	StartTime         time.Time
 }
 
 func NewApp(ctx context.Context, cfg *config.Config, version string) (*App, error) {
@@ -34,21 +38,31 @@ func NewApp(ctx context.Context, cfg *config.Config, version string) (*App, erro
 
 	tokenService := token.NewTokenService(dbService)
 	authService := auth.NewAuthService(dbService, tokenService)
-	groupService := group.NewGroupService(dbService)
 	realtimeService := realtime.NewRealtimeService(ctx, dbService)
-	messageService := message.NewMessageService(dbService, realtimeService)
+	groupService := group.NewGroupService(dbService, realtimeService)
+	messageService := message.NewMessageService(dbService, realtimeService, cfg.MessageEditWindow)
+	realtimeService.HandleFrame("mark_read", messageService.HandleMarkReadFrame)
+	inviteService := invite.NewInviteService(dbService, groupService)
+	blobStore, err := attachment.NewBlobStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	attachmentService := attachment.NewAttachmentService(dbService, blobStore, cfg.AttachmentMaxSize, cfg.AttachmentAllowedTypes)
+	go attachmentService.RunSweeper(ctx, cfg.AttachmentSweepInterval, cfg.AttachmentUnsentTTL)
 
 	app := &App{
-		Ctx:             ctx,
-		RealtimeService: realtimeService,
-		DatabaseService: dbService,
-		GroupService:    groupService,
-		MessageService:  messageService,
-		AuthService:     authService,
-		TokenService:    tokenService,
-		Config:          cfg,
-		Version:         version,
-		StartTime:       time.Now(),
+		Ctx:               ctx,
+		RealtimeService:   realtimeService,
+		DatabaseService:   dbService,
+		GroupService:      groupService,
+		InviteService:     inviteService,
+		MessageService:    messageService,
+		AttachmentService: attachmentService,
+		AuthService:       authService,
+		TokenService:      tokenService,
+		Config:            cfg,
+		Version:           version,
+		StartTime:         time.Now(),
 	}
 
 	return app, nil
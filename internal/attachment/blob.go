@@ -0,0 +1,118 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ananthvk/gochat/internal/config"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores the contents of attachments, the keys are generated by the attachment service and are safe to use as
+// paths
+type BlobStore interface {
+	// Put stores size bytes read from r under the key, replacing the existing blob (if any)
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the contents of the blob, ErrBlobNotFound is returned if there is no blob with the key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob, it does not return an error if there is no blob with the key
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalBlobStore stores blobs as files under a directory of the local disk
+type LocalBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore creates a blob store under the directory root, the directory is created if it does not exist
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+func (l *LocalBlobStore) path(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(l.root, key), nil
+}
+
+// Put writes the blob to a temporary file first, so that a partially written blob is never visible
+func (l *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(r, size))
+	if err == nil && written != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// NewBlobStore creates the blob store configured by GOCHAT_BLOB_STORE
+func NewBlobStore(cfg *config.Config) (BlobStore, error) {
+	var store BlobStore
+	var err error
+	switch cfg.BlobStore {
+	case "local":
+		store, err = NewLocalBlobStore(cfg.BlobDir)
+	case "s3":
+		store, err = NewS3BlobStore(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	default:
+		err = fmt.Errorf("unknown blob store %q, expected local or s3", cfg.BlobStore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
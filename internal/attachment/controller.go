@@ -0,0 +1,113 @@
+package attachment
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ananthvk/gochat/internal/auth"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/ananthvk/gochat/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// The multipart form can be larger than the file because of the boundaries and the headers of the parts
+	maxMultipartOverhead = 1 << 20
+	// The part of the multipart form which is kept in memory, the rest is written to temporary files
+	maxMultipartMemory = 1 << 20
+)
+
+func Routes(a *AttachmentService, middlewares middleware.Middlewares) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middlewares.Authenticate)
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) { handleUploadAttachment(a, w, r) })
+	router.Get("/{attachment_id}", func(w http.ResponseWriter, r *http.Request) { handleDownloadAttachment(a, w, r) })
+	return router
+}
+
+// Uploads the file in the "file" field of a multipart form, the returned id is then sent in the attachment_ids of a message
+func handleUploadAttachment(a *AttachmentService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot upload attachment without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.MaxSize()+maxMultipartOverhead)
+	err = r.ParseMultipartForm(maxMultipartMemory)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			helpers.RespondWithError(w, http.StatusRequestEntityTooLarge, errs.ErrTooLarge, "attachment is too large")
+			return
+		}
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+
+	attachment, appErr := a.Upload(r.Context(), groupId, userId, header.Filename, file, header.Size)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusCreated, Response(attachment))
+}
+
+func handleDownloadAttachment(a *AttachmentService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot download attachment without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	attachmentId, err := ulid.Parse(chi.URLParam(r, "attachment_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid attachment_id")
+		return
+	}
+	attachment, contents, appErr := a.Download(r.Context(), attachmentId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	defer contents.Close()
+
+	// Images are displayed by the browser, other files are always downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, contents); err != nil {
+		slog.ErrorContext(r.Context(), "error while sending attachment", "error", err)
+	}
+}
@@ -0,0 +1,177 @@
+package attachment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ananthvk/gochat/internal/database"
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/membership"
+	"github.com/oklog/ulid/v2"
+)
+
+// The number of bytes used to detect the content type of a file, see http.DetectContentType
+const sniffLength = 512
+
+const maxFilenameLength = 255
+
+type AttachmentService struct {
+	Db           *database.DatabaseService
+	store        BlobStore
+	maxSize      int64
+	allowedTypes []string
+}
+
+// NewAttachmentService creates an attachment service, attachments can have atmost maxSize bytes, and only the content types in
+// allowedTypes can be uploaded
+func NewAttachmentService(databaseService *database.DatabaseService, store BlobStore, maxSize int64, allowedTypes []string) *AttachmentService {
+	return &AttachmentService{
+		Db:           databaseService,
+		store:        store,
+		maxSize:      maxSize,
+		allowedTypes: allowedTypes,
+	}
+}
+
+// Upload stores a file of the given size in the group. The content type is detected from the contents of the file, the type
+// sent by the client is not trusted
+func (a *AttachmentService) Upload(ctx context.Context, groupId, userId ulid.ULID, filename string, file io.ReadSeeker, size int64) (*db.Attachment, *errs.Error) {
+	if size > a.maxSize {
+		return nil, errs.TooLarge(fmt.Sprintf("attachments can have atmost %d bytes", a.maxSize))
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, a.Db.QueryTimeout)
+	defer cancel()
+	appErr := membership.IsUserMemberOfGroup(a.Db, dbCtx, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	contentType, err := detectContentType(file)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while reading attachment", "error", err)
+		return nil, errs.Internal("internal server error while uploading attachment")
+	}
+	if !slices.Contains(a.allowedTypes, contentType) {
+		return nil, errs.ValidationFailed(fmt.Sprintf("attachments of type %s are not allowed", contentType))
+	}
+
+	id := ulid.Make()
+	key := groupId.String() + "/" + id.String()
+	// The blob is stored first, so that an attachment never refers to a missing blob
+	if err := a.store.Put(ctx, key, file, size, contentType); err != nil {
+		slog.ErrorContext(ctx, "internal error while storing attachment", "error", err)
+		return nil, errs.Internal("internal server error while uploading attachment")
+	}
+
+	dbCtx, cancel = context.WithTimeout(ctx, a.Db.QueryTimeout)
+	defer cancel()
+	attachment, err := a.Db.Queries.CreateAttachment(dbCtx, db.CreateAttachmentParams{
+		ID:          id[:],
+		GrpID:       groupId[:],
+		UploaderID:  userId[:],
+		Filename:    sanitizeFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		StorageKey:  key,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating attachment", "error", err)
+		if err := a.store.Delete(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "internal error while deleting blob", "error", err, "key", key)
+		}
+		return nil, errs.Internal("internal server error while uploading attachment")
+	}
+	return attachment, nil
+}
+
+// Download returns an attachment along with its contents, the caller should close the contents. The attachments of a group can
+// be downloaded by its members, unless the message of the attachment has been deleted. Attachments which have not been sent in
+// a message can only be downloaded by the uploader
+func (a *AttachmentService) Download(ctx context.Context, attachmentId, groupId, userId ulid.ULID) (*db.Attachment, io.ReadCloser, *errs.Error) {
+	dbCtx, cancel := context.WithTimeout(ctx, a.Db.QueryTimeout)
+	defer cancel()
+
+	appErr := membership.IsUserMemberOfGroup(a.Db, dbCtx, groupId, userId)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	attachment, err := a.Db.Queries.GetAttachment(dbCtx, db.GetAttachmentParams{ID: attachmentId[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching attachment", "error", err)
+			return nil, nil, errs.Internal("internal server error while fetching attachment")
+		}
+		return nil, nil, errs.NotFound("attachment with the given id not found")
+	}
+	if attachment.MessageID == nil {
+		if ulid.ULID(attachment.UploaderID) != userId {
+			return nil, nil, errs.NotFound("attachment with the given id not found")
+		}
+	} else {
+		message, err := a.Db.Queries.GetMessage(dbCtx, db.GetMessageParams{ID: attachment.MessageID, GrpID: groupId[:]})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, nil, errs.Internal("internal server error while fetching attachment")
+		}
+		if message.DeletedAt.Valid {
+			return nil, nil, errs.NotFound("attachment with the given id not found")
+		}
+	}
+
+	contents, err := a.store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			return nil, nil, errs.NotFound("attachment with the given id not found")
+		}
+		slog.ErrorContext(ctx, "internal error while fetching blob", "error", err, "key", attachment.StorageKey)
+		return nil, nil, errs.Internal("internal server error while fetching attachment")
+	}
+	return attachment, contents, nil
+}
+
+// MaxSize returns the maximum size of an attachment in bytes
+func (a *AttachmentService) MaxSize() int64 {
+	return a.maxSize
+}
+
+// detectContentType detects the media type of the file from its first bytes, and rewinds the file
+func detectContentType(file io.ReadSeeker) (string, error) {
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "", err
+	}
+	return mediaType, nil
+}
+
+// sanitizeFilename drops the directories from the name of an uploaded file, and limits its length
+func sanitizeFilename(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	runes := []rune(name)
+	if len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	return name
+}
@@ -0,0 +1,55 @@
+package attachment
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The number of blobs deleted in one pass of the sweeper
+const sweepBatchSize = 100
+
+// RunSweeper runs Sweep every interval until the context is cancelled
+func (a *AttachmentService) RunSweeper(ctx context.Context, interval, unsentTTL time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.Sweep(ctx, unsentTTL)
+		}
+	}
+}
+
+// Sweep deletes the attachments which have not been sent in a message within unsentTTL of their upload, and removes the blobs
+// of deleted attachments from the blob store. A blob that could not be deleted stays queued, and is retried in the next pass
+func (a *AttachmentService) Sweep(ctx context.Context, unsentTTL time.Duration) {
+	dbCtx, cancel := context.WithTimeout(ctx, a.Db.QueryTimeout)
+	defer cancel()
+
+	expired, err := a.Db.Queries.DeleteUnsentAttachments(dbCtx, pgtype.Timestamptz{Time: time.Now().Add(-unsentTTL), Valid: true})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting unsent attachments", "error", err)
+	} else if expired > 0 {
+		slog.InfoContext(ctx, "deleted unsent attachments", "count", expired)
+	}
+
+	keys, err := a.Db.Queries.GetBlobDeletions(dbCtx, sweepBatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching blobs to delete", "error", err)
+		return
+	}
+	for _, key := range keys {
+		if err := a.store.Delete(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "internal error while deleting blob", "error", err, "key", key)
+			continue
+		}
+		if err := a.Db.Queries.DeleteBlobDeletion(dbCtx, key); err != nil {
+			slog.ErrorContext(ctx, "internal error while dequeuing blob", "error", err, "key", key)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package attachment
+
+import (
+	"time"
+
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/oklog/ulid/v2"
+)
+
+type AttachmentResponse struct {
+	Id         string `json:"id"`
+	GrpId      string `json:"group_id"`
+	UploaderId string `json:"uploader_id"`
+	// The message which references the attachment, nil until the attachment has been sent in a message
+	MessageId   *string   `json:"message_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func Response(attachment *db.Attachment) AttachmentResponse {
+	resp := AttachmentResponse{
+		Id:          ulid.ULID(attachment.ID).String(),
+		GrpId:       ulid.ULID(attachment.GrpID).String(),
+		UploaderId:  ulid.ULID(attachment.UploaderID).String(),
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		CreatedAt:   attachment.CreatedAt.Time,
+	}
+	if attachment.MessageID != nil {
+		messageId := ulid.ULID(attachment.MessageID).String()
+		resp.MessageId = &messageId
+	}
+	return resp
+}
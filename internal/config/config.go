@@ -15,6 +15,18 @@ type Config struct {
 	DbDSN                     string        `env:"GOCHAT_DB_DSN,notEmpty"`
 	DbPingTimeout             time.Duration `env:"GOCHAT_DB_PING_TIMEOUT,notEmpty" envDefault:"5s"`
 	DbQueryTimeout            time.Duration `env:"GOCHAT_DB_QUERY_TIMEOUT,notEmpty" envDefault:"5s"`
+	MessageEditWindow         time.Duration `env:"GOCHAT_MESSAGE_EDIT_WINDOW" envDefault:"0s"`
+	AttachmentMaxSize         int64         `env:"GOCHAT_ATTACHMENT_MAX_SIZE" envDefault:"10485760"`
+	AttachmentAllowedTypes    []string      `env:"GOCHAT_ATTACHMENT_ALLOWED_TYPES" envDefault:"image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"`
+	AttachmentUnsentTTL       time.Duration `env:"GOCHAT_ATTACHMENT_UNSENT_TTL" envDefault:"24h"`
+	AttachmentSweepInterval   time.Duration `env:"GOCHAT_ATTACHMENT_SWEEP_INTERVAL" envDefault:"10m"`
+	BlobStore                 string        `env:"GOCHAT_BLOB_STORE" envDefault:"local"`
+	BlobDir                   string        `env:"GOCHAT_BLOB_DIR" envDefault:"data/blobs"`
+	S3Endpoint                string        `env:"GOCHAT_S3_ENDPOINT"`
+	S3Region                  string        `env:"GOCHAT_S3_REGION" envDefault:"us-east-1"`
+	S3Bucket                  string        `env:"GOCHAT_S3_BUCKET"`
+	S3AccessKey               string        `env:"GOCHAT_S3_ACCESS_KEY"`
+	S3SecretKey               string        `env:"GOCHAT_S3_SECRET_KEY"`
 }
 
 func LoadEnv() {
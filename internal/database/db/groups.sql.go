@@ -22,9 +22,31 @@ func (q *Queries) CheckGroupExists(ctx context.Context, id []byte) (bool, error)
 	return exists, err
 }
 
+const createDirectGroup = `-- name: CreateDirectGroup :one
+
+INSERT INTO grp (id, name, description, owner_id, kind, dm_pair, visibility)
+VALUES ($1, '', '', $2, 'direct', $3, 'private')
+ON CONFLICT (dm_pair) DO NOTHING
+RETURNING id
+`
+
+type CreateDirectGroupParams struct {
+	ID      []byte `json:"id"`
+	OwnerID []byte `json:"owner_id"`
+	DmPair  []byte `json:"dm_pair"`
+}
+
+// Creates a direct conversation, if a direct conversation between the pair of users already exists, no row is returned
+func (q *Queries) CreateDirectGroup(ctx context.Context, arg CreateDirectGroupParams) ([]byte, error) {
+	row := q.db.QueryRow(ctx, createDirectGroup, arg.ID, arg.OwnerID, arg.DmPair)
+	var id []byte
+	err := row.Scan(&id)
+	return id, err
+}
+
 const createGroup = `-- name: CreateGroup :one
-INSERT INTO grp (id, name, description, owner_id)
-VALUES ($1, $2, $3, $4)
+INSERT INTO grp (id, name, description, owner_id, visibility)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING id
 `
 
@@ -33,6 +55,7 @@ type CreateGroupParams struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	OwnerID     []byte `json:"owner_id"`
+	Visibility  string `json:"visibility"`
 }
 
 func (q *Queries) CreateGroup(ctx context.Context, arg CreateGroupParams) ([]byte, error) {
@@ -41,6 +64,7 @@ func (q *Queries) CreateGroup(ctx context.Context, arg CreateGroupParams) ([]byt
 		arg.Name,
 		arg.Description,
 		arg.OwnerID,
+		arg.Visibility,
 	)
 	var id []byte
 	err := row.Scan(&id)
@@ -57,8 +81,32 @@ func (q *Queries) DeleteGroup(ctx context.Context, id []byte) error {
 	return err
 }
 
+const getDirectGroupByPair = `-- name: GetDirectGroupByPair :one
+SELECT name, description, created_at, id, owner_id, kind, dm_pair, visibility, last_message_id, last_message_at, message_count FROM grp
+WHERE dm_pair = $1 LIMIT 1
+`
+
+func (q *Queries) GetDirectGroupByPair(ctx context.Context, dmPair []byte) (*Grp, error) {
+	row := q.db.QueryRow(ctx, getDirectGroupByPair, dmPair)
+	var i Grp
+	err := row.Scan(
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+		&i.ID,
+		&i.OwnerID,
+		&i.Kind,
+		&i.DmPair,
+		&i.Visibility,
+		&i.LastMessageID,
+		&i.LastMessageAt,
+		&i.MessageCount,
+	)
+	return &i, err
+}
+
 const getGroup = `-- name: GetGroup :one
-SELECT name, description, created_at, id, owner_id FROM grp
+SELECT name, description, created_at, id, owner_id, kind, dm_pair, visibility, last_message_id, last_message_at, message_count FROM grp
 WHERE id = $1 LIMIT 1
 `
 
@@ -71,62 +119,113 @@ func (q *Queries) GetGroup(ctx context.Context, id []byte) (*Grp, error) {
 		&i.CreatedAt,
 		&i.ID,
 		&i.OwnerID,
+		&i.Kind,
+		&i.DmPair,
+		&i.Visibility,
+		&i.LastMessageID,
+		&i.LastMessageAt,
+		&i.MessageCount,
 	)
 	return &i, err
 }
 
 const getGroups = `-- name: GetGroups :many
 SELECT 
-    g.name, g.description, g.created_at, g.id, g.owner_id,
+    g.name, g.description, g.created_at, g.id, g.owner_id, g.kind, g.dm_pair, g.visibility, g.last_message_id, g.last_message_at, g.message_count,
     mem.role,
     mem.joined_at,
+    mem.last_read_message_id,
     m.content AS last_message_content,
-    m.created_at AS last_message_created_at,
-    last_message_id,
     m.sender_id AS last_message_sender_id,
     m.type AS last_message_type,
-    u.name AS last_message_sender_name
+    m.payload AS last_message_payload,
+    u.name AS last_message_sender_name,
+    peer.id AS peer_id,
+    peer.name AS peer_name,
+    peer.username AS peer_username,
+    COALESCE(g.last_message_id, g.id)::bytea AS last_activity_id,
+    mem.unread_count,
+    (
+        SELECT um.id FROM message AS um
+        WHERE
+            mem.unread_count > 0
+        AND
+            um.grp_id = g.id
+        AND
+            (mem.last_read_message_id IS NULL OR um.id > mem.last_read_message_id)
+        AND
+            um.thread_root_id IS NULL
+        AND
+            um.deleted_at IS NULL
+        AND
+            um.sender_id <> mem.usr_id
+        ORDER BY um.id
+        LIMIT 1
+    ) AS first_unread_id
 FROM grp AS g
 INNER JOIN grp_membership AS mem
     ON g.id = mem.grp_id
-LEFT JOIN (
-    SELECT DISTINCT ON (grp_id)
-        grp_id,
-        id AS last_message_id
-    FROM message
-    ORDER BY grp_id, id DESC
-) AS lm 
-    ON lm.grp_id = g.id
 LEFT JOIN message as m
-    ON m.id = lm.last_message_id
+    ON m.id = g.last_message_id
 LEFT JOIN usr AS u
     ON u.id = m.sender_id
-WHERE mem.usr_id  = $1
-ORDER BY lm.last_message_id DESC NULLS LAST
+LEFT JOIN grp_membership AS peer_mem
+    ON g.kind = 'direct' AND peer_mem.grp_id = g.id AND peer_mem.usr_id <> mem.usr_id
+LEFT JOIN usr AS peer
+    ON peer.id = peer_mem.usr_id
+WHERE
+    mem.usr_id  = $1
+AND
+    ($2::bytea IS NULL OR COALESCE(g.last_message_id, g.id) < $2::bytea)
+ORDER BY last_activity_id DESC
+LIMIT $3
 `
 
+type GetGroupsParams struct {
+	UsrID  []byte `json:"usr_id"`
+	Before []byte `json:"before"`
+	Limit  int32  `json:"limit"`
+}
+
 type GetGroupsRow struct {
 	Name                  string             `json:"name"`
 	Description           string             `json:"description"`
 	CreatedAt             pgtype.Timestamptz `json:"created_at"`
 	ID                    []byte             `json:"id"`
 	OwnerID               []byte             `json:"owner_id"`
+	Kind                  string             `json:"kind"`
+	DmPair                []byte             `json:"dm_pair"`
+	Visibility            string             `json:"visibility"`
+	LastMessageID         []byte             `json:"last_message_id"`
+	LastMessageAt         pgtype.Timestamptz `json:"last_message_at"`
+	MessageCount          int64              `json:"message_count"`
 	Role                  string             `json:"role"`
 	JoinedAt              pgtype.Timestamptz `json:"joined_at"`
+	LastReadMessageID     []byte             `json:"last_read_message_id"`
 	LastMessageContent    pgtype.Text        `json:"last_message_content"`
-	LastMessageCreatedAt  pgtype.Timestamptz `json:"last_message_created_at"`
-	LastMessageID         []byte             `json:"last_message_id"`
 	LastMessageSenderID   []byte             `json:"last_message_sender_id"`
 	LastMessageType       pgtype.Text        `json:"last_message_type"`
+	LastMessagePayload    []byte             `json:"last_message_payload"`
 	LastMessageSenderName pgtype.Text        `json:"last_message_sender_name"`
+	PeerID                []byte             `json:"peer_id"`
+	PeerName              pgtype.Text        `json:"peer_name"`
+	PeerUsername          pgtype.Text        `json:"peer_username"`
+	LastActivityID        []byte             `json:"last_activity_id"`
+	UnreadCount           int32              `json:"unread_count"`
+	FirstUnreadID         []byte             `json:"first_unread_id"`
 }
 
-// Returns detailed information about all groups the user is part of
-// Also sorts the returned groups by the last message sent timestamp
-// Also returns the last message (if any) of the group
+// Returns detailed information about the groups the user is part of
+// Also sorts the returned groups by the last activity, which is the id of the last message, or the id of the group if no message has been sent
+// Since ids are ULIDs, the last activity is unique and time ordered, so it is used as the pagination cursor
+// The last activity changes when a message is sent or deleted, so the cursor is best-effort, clients merge the realtime events
+// Also returns the last message (if any) of the group, it is looked up using the denormalized last_message_id of the group
 // Also joins with the user table, and returns the sender name, so that it can be directly rendered in the sidebar
-func (q *Queries) GetGroups(ctx context.Context, usrID []byte) ([]*GetGroupsRow, error) {
-	rows, err := q.db.Query(ctx, getGroups, usrID)
+// For direct conversations, the other participant is also returned, so that their name can be shown in the sidebar
+// Also returns the number of unread messages in the timeline, which is kept in the membership, and the first unread message, which is only
+// looked up if there are unread messages. Messages sent by the user are never unread
+func (q *Queries) GetGroups(ctx context.Context, arg GetGroupsParams) ([]*GetGroupsRow, error) {
+	rows, err := q.db.Query(ctx, getGroups, arg.UsrID, arg.Before, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -140,14 +239,97 @@ func (q *Queries) GetGroups(ctx context.Context, usrID []byte) ([]*GetGroupsRow,
 			&i.CreatedAt,
 			&i.ID,
 			&i.OwnerID,
+			&i.Kind,
+			&i.DmPair,
+			&i.Visibility,
+			&i.LastMessageID,
+			&i.LastMessageAt,
+			&i.MessageCount,
 			&i.Role,
 			&i.JoinedAt,
+			&i.LastReadMessageID,
 			&i.LastMessageContent,
-			&i.LastMessageCreatedAt,
-			&i.LastMessageID,
 			&i.LastMessageSenderID,
 			&i.LastMessageType,
+			&i.LastMessagePayload,
 			&i.LastMessageSenderName,
+			&i.PeerID,
+			&i.PeerName,
+			&i.PeerUsername,
+			&i.LastActivityID,
+			&i.UnreadCount,
+			&i.FirstUnreadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPublicGroups = `-- name: GetPublicGroups :many
+SELECT
+    g.name, g.description, g.created_at, g.id, g.owner_id, g.kind, g.dm_pair, g.visibility, g.last_message_id, g.last_message_at, g.message_count,
+    (SELECT COUNT(*) FROM grp_membership AS mem WHERE mem.grp_id = g.id) AS member_count
+FROM grp AS g
+WHERE
+    g.visibility = 'public'
+AND
+    ($1::bytea IS NULL OR g.id < $1::bytea)
+AND
+    ($2::text IS NULL OR g.name ILIKE $2::text OR g.description ILIKE $2::text)
+ORDER BY g.id DESC
+LIMIT $3
+`
+
+type GetPublicGroupsParams struct {
+	Before []byte      `json:"before"`
+	Query  pgtype.Text `json:"query"`
+	Limit  int32       `json:"limit"`
+}
+
+type GetPublicGroupsRow struct {
+	Name          string             `json:"name"`
+	Description   string             `json:"description"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	ID            []byte             `json:"id"`
+	OwnerID       []byte             `json:"owner_id"`
+	Kind          string             `json:"kind"`
+	DmPair        []byte             `json:"dm_pair"`
+	Visibility    string             `json:"visibility"`
+	LastMessageID []byte             `json:"last_message_id"`
+	LastMessageAt pgtype.Timestamptz `json:"last_message_at"`
+	MessageCount  int64              `json:"message_count"`
+	MemberCount   int64              `json:"member_count"`
+}
+
+// Returns public groups along with the number of members in each group, newest groups first
+// query is a pattern that is matched against the name and the description (case insensitive)
+func (q *Queries) GetPublicGroups(ctx context.Context, arg GetPublicGroupsParams) ([]*GetPublicGroupsRow, error) {
+	rows, err := q.db.Query(ctx, getPublicGroups, arg.Before, arg.Query, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetPublicGroupsRow
+	for rows.Next() {
+		var i GetPublicGroupsRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+			&i.ID,
+			&i.OwnerID,
+			&i.Kind,
+			&i.DmPair,
+			&i.Visibility,
+			&i.LastMessageID,
+			&i.LastMessageAt,
+			&i.MessageCount,
+			&i.MemberCount,
 		); err != nil {
 			return nil, err
 		}
@@ -159,23 +341,74 @@ func (q *Queries) GetGroups(ctx context.Context, usrID []byte) ([]*GetGroupsRow,
 	return items, nil
 }
 
+const lockGroupForBan = `-- name: LockGroupForBan :exec
+
+SELECT id FROM grp
+WHERE id = $1
+FOR UPDATE
+`
+
+// Locks the group while a user is banned, so that members cannot be added until the ban is committed
+func (q *Queries) LockGroupForBan(ctx context.Context, id []byte) error {
+	_, err := q.db.Exec(ctx, lockGroupForBan, id)
+	return err
+}
+
+const lockGroupForJoin = `-- name: LockGroupForJoin :exec
+
+SELECT id FROM grp
+WHERE id = $1
+FOR KEY SHARE
+`
+
+// Locks the group while a member is added, so that a concurrent ban of the user waits until the membership is committed. KEY SHARE
+// does not conflict with the updates of the last message of the group
+func (q *Queries) LockGroupForJoin(ctx context.Context, id []byte) error {
+	_, err := q.db.Exec(ctx, lockGroupForJoin, id)
+	return err
+}
+
+const refreshGroupLastMessage = `-- name: RefreshGroupLastMessage :exec
+
+UPDATE grp
+SET
+    last_message_id = (SELECT id FROM message WHERE grp_id = $1 AND deleted_at IS NULL AND thread_root_id IS NULL ORDER BY id DESC LIMIT 1),
+    last_message_at = (SELECT created_at FROM message WHERE grp_id = $1 AND deleted_at IS NULL AND thread_root_id IS NULL ORDER BY id DESC LIMIT 1),
+    message_count = message_count - 1
+WHERE id = $1
+`
+
+// Decrements the message count after a message has been deleted, and recomputes the last message of the group, deleted messages
+// are neither counted nor shown as the last message. Replies in threads are not part of the timeline, so they are never counted
+func (q *Queries) RefreshGroupLastMessage(ctx context.Context, id []byte) error {
+	_, err := q.db.Exec(ctx, refreshGroupLastMessage, id)
+	return err
+}
+
 const updateGroupById = `-- name: UpdateGroupById :one
 UPDATE grp 
 SET
     name = coalesce($1, name),
-    description = coalesce($2, description)
-WHERE id = $3
-RETURNING name, description, created_at, id, owner_id
+    description = coalesce($2, description),
+    visibility = coalesce($3, visibility)
+WHERE id = $4
+RETURNING name, description, created_at, id, owner_id, kind, dm_pair, visibility, last_message_id, last_message_at, message_count
 `
 
 type UpdateGroupByIdParams struct {
 	Name        pgtype.Text `json:"name"`
 	Description pgtype.Text `json:"description"`
+	Visibility  pgtype.Text `json:"visibility"`
 	ID          []byte      `json:"id"`
 }
 
 func (q *Queries) UpdateGroupById(ctx context.Context, arg UpdateGroupByIdParams) (*Grp, error) {
-	row := q.db.QueryRow(ctx, updateGroupById, arg.Name, arg.Description, arg.ID)
+	row := q.db.QueryRow(ctx, updateGroupById,
+		arg.Name,
+		arg.Description,
+		arg.Visibility,
+		arg.ID,
+	)
 	var i Grp
 	err := row.Scan(
 		&i.Name,
@@ -183,6 +416,61 @@ func (q *Queries) UpdateGroupById(ctx context.Context, arg UpdateGroupByIdParams
 		&i.CreatedAt,
 		&i.ID,
 		&i.OwnerID,
+		&i.Kind,
+		&i.DmPair,
+		&i.Visibility,
+		&i.LastMessageID,
+		&i.LastMessageAt,
+		&i.MessageCount,
 	)
 	return &i, err
 }
+
+const updateGroupLastMessage = `-- name: UpdateGroupLastMessage :exec
+
+UPDATE grp
+SET
+    last_message_id = CASE WHEN last_message_id IS NULL OR last_message_id < $1 THEN $1 ELSE last_message_id END,
+    last_message_at = CASE WHEN last_message_id IS NULL OR last_message_id < $1 THEN $2 ELSE last_message_at END,
+    message_count = message_count + 1
+WHERE id = $3
+`
+
+type UpdateGroupLastMessageParams struct {
+	LastMessageID []byte             `json:"last_message_id"`
+	LastMessageAt pgtype.Timestamptz `json:"last_message_at"`
+	ID            []byte             `json:"id"`
+}
+
+// Records a new message as the last message of the group, and increments the message count. The last message is only replaced
+// if the new message is newer, so that concurrent transactions cannot move it backwards
+func (q *Queries) UpdateGroupLastMessage(ctx context.Context, arg UpdateGroupLastMessageParams) error {
+	_, err := q.db.Exec(ctx, updateGroupLastMessage, arg.LastMessageID, arg.LastMessageAt, arg.ID)
+	return err
+}
+
+const updateGroupOwner = `-- name: UpdateGroupOwner :execrows
+
+UPDATE grp
+SET owner_id = $1
+WHERE
+    id = $2
+        AND
+    owner_id = $3
+`
+
+type UpdateGroupOwnerParams struct {
+	OwnerID         []byte `json:"owner_id"`
+	ID              []byte `json:"id"`
+	PreviousOwnerID []byte `json:"previous_owner_id"`
+}
+
+// Changes the owner of a group if it is still owned by the previous owner, so that concurrent transfers cannot both succeed.
+// The roles of the memberships have to be updated in the same transaction
+func (q *Queries) UpdateGroupOwner(ctx context.Context, arg UpdateGroupOwnerParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateGroupOwner, arg.OwnerID, arg.ID, arg.PreviousOwnerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -11,6 +11,48 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const advanceLastReadMessage = `-- name: AdvanceLastReadMessage :execrows
+
+UPDATE grp_membership AS mem
+SET
+    last_read_message_id = $1,
+    unread_count = (
+        SELECT COUNT(*) FROM message AS m
+        WHERE
+            m.grp_id = mem.grp_id
+        AND
+            m.id > $1
+        AND
+            m.thread_root_id IS NULL
+        AND
+            m.deleted_at IS NULL
+        AND
+            m.sender_id <> mem.usr_id
+    )
+WHERE
+    grp_id = $2
+        AND
+    usr_id = $3
+        AND
+    (last_read_message_id IS NULL OR last_read_message_id < $1)
+`
+
+type AdvanceLastReadMessageParams struct {
+	LastReadMessageID []byte `json:"last_read_message_id"`
+	GrpID             []byte `json:"grp_id"`
+	UsrID             []byte `json:"usr_id"`
+}
+
+// Moves the read marker of the member forward to the given message, the marker never moves backward. The unread count is
+// recounted from the new marker, which only covers the messages that are still unread
+func (q *Queries) AdvanceLastReadMessage(ctx context.Context, arg AdvanceLastReadMessageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, advanceLastReadMessage, arg.LastReadMessageID, arg.GrpID, arg.UsrID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const checkMembership = `-- name: CheckMembership :one
 
 SELECT EXISTS(
@@ -37,24 +79,83 @@ func (q *Queries) CheckMembership(ctx context.Context, arg CheckMembershipParams
 
 const createMembership = `-- name: CreateMembership :one
 
-INSERT INTO grp_membership (grp_id, usr_id, role)
-VALUES ($1, $2, 'member')
+INSERT INTO grp_membership (grp_id, usr_id, role, last_read_message_id)
+VALUES ($1, $2, $3, (SELECT last_message_id FROM grp WHERE id = $1))
 RETURNING joined_at
 `
 
 type CreateMembershipParams struct {
 	GrpID []byte `json:"grp_id"`
 	UsrID []byte `json:"usr_id"`
+	Role  string `json:"role"`
 }
 
-// Add a user to a group
+// Add a user to a group, the read marker of the member starts at the last message of the group, since the messages sent before
+// the member joined are never unread
 func (q *Queries) CreateMembership(ctx context.Context, arg CreateMembershipParams) (pgtype.Timestamptz, error) {
-	row := q.db.QueryRow(ctx, createMembership, arg.GrpID, arg.UsrID)
+	row := q.db.QueryRow(ctx, createMembership, arg.GrpID, arg.UsrID, arg.Role)
+	var joined_at pgtype.Timestamptz
+	err := row.Scan(&joined_at)
+	return joined_at, err
+}
+
+const createMembershipIfNotBanned = `-- name: CreateMembershipIfNotBanned :one
+
+INSERT INTO grp_membership (grp_id, usr_id, role, last_read_message_id)
+SELECT $1::bytea, $2::bytea, $3::text, (SELECT last_message_id FROM grp WHERE id = $1)
+WHERE NOT EXISTS (
+    SELECT 1 FROM grp_ban
+    WHERE
+        grp_id = $1
+            AND
+        usr_id = $2
+            AND
+        (expires_at IS NULL OR expires_at > NOW())
+)
+RETURNING joined_at
+`
+
+type CreateMembershipIfNotBannedParams struct {
+	GrpID []byte `json:"grp_id"`
+	UsrID []byte `json:"usr_id"`
+	Role  string `json:"role"`
+}
+
+// Add a user to a group unless the user is currently banned from it, no row is returned if the user is banned. The group has to be
+// locked with LockGroupForJoin, so that a ban which is being committed is seen
+func (q *Queries) CreateMembershipIfNotBanned(ctx context.Context, arg CreateMembershipIfNotBannedParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, createMembershipIfNotBanned, arg.GrpID, arg.UsrID, arg.Role)
 	var joined_at pgtype.Timestamptz
 	err := row.Scan(&joined_at)
 	return joined_at, err
 }
 
+const decrementUnreadCounts = `-- name: DecrementUnreadCounts :exec
+
+UPDATE grp_membership
+SET unread_count = unread_count - 1
+WHERE
+    grp_id = $1
+        AND
+    usr_id <> $2
+        AND
+    unread_count > 0
+        AND
+    (last_read_message_id IS NULL OR last_read_message_id < $3)
+`
+
+type DecrementUnreadCountsParams struct {
+	GrpID     []byte `json:"grp_id"`
+	SenderID  []byte `json:"sender_id"`
+	MessageID []byte `json:"message_id"`
+}
+
+// Removes a deleted message of the timeline from the unread count of the members who have not read it yet
+func (q *Queries) DecrementUnreadCounts(ctx context.Context, arg DecrementUnreadCountsParams) error {
+	_, err := q.db.Exec(ctx, decrementUnreadCounts, arg.GrpID, arg.SenderID, arg.MessageID)
+	return err
+}
+
 const deleteMembership = `-- name: DeleteMembership :exec
 
 DELETE FROM grp_membership
@@ -75,25 +176,75 @@ func (q *Queries) DeleteMembership(ctx context.Context, arg DeleteMembershipPara
 	return err
 }
 
+const getGroupMemberByUsername = `-- name: GetGroupMemberByUsername :one
+
+SELECT m.usr_id FROM
+grp_membership AS m
+INNER JOIN usr AS u
+ON m.usr_id = u.id
+WHERE
+    m.grp_id = $1
+        AND
+    u.username = $2
+LIMIT 1
+`
+
+type GetGroupMemberByUsernameParams struct {
+	GrpID    []byte `json:"grp_id"`
+	Username string `json:"username"`
+}
+
+// Returns the id of the member of the group with the given username, used to resolve mentions
+func (q *Queries) GetGroupMemberByUsername(ctx context.Context, arg GetGroupMemberByUsernameParams) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getGroupMemberByUsername, arg.GrpID, arg.Username)
+	var usr_id []byte
+	err := row.Scan(&usr_id)
+	return usr_id, err
+}
+
 const getGroupMembersWithName = `-- name: GetGroupMembersWithName :many
-SELECT m.grp_id, m.usr_id, m.role, m.joined_at, u.username, u.name FROM 
+
+SELECT m.grp_id, m.usr_id, m.role, m.joined_at, m.last_read_message_id, m.unread_count, u.username, u.name FROM 
 grp_membership AS m 
 INNER JOIN usr AS u
 ON m.usr_id = u.id
-WHERE grp_id = $1
+WHERE
+    grp_id = $1
+AND
+    ($2::bytea IS NULL OR m.usr_id < $2::bytea)
+AND
+    ($3::text IS NULL OR u.name ILIKE $3::text OR u.username ILIKE $3::text)
+ORDER BY m.usr_id DESC
+LIMIT $4
 `
 
+type GetGroupMembersWithNameParams struct {
+	GrpID  []byte      `json:"grp_id"`
+	Before []byte      `json:"before"`
+	Query  pgtype.Text `json:"query"`
+	Limit  int32       `json:"limit"`
+}
+
 type GetGroupMembersWithNameRow struct {
-	GrpID    []byte             `json:"grp_id"`
-	UsrID    []byte             `json:"usr_id"`
-	Role     string             `json:"role"`
-	JoinedAt pgtype.Timestamptz `json:"joined_at"`
-	Username string             `json:"username"`
-	Name     string             `json:"name"`
+	GrpID             []byte             `json:"grp_id"`
+	UsrID             []byte             `json:"usr_id"`
+	Role              string             `json:"role"`
+	JoinedAt          pgtype.Timestamptz `json:"joined_at"`
+	LastReadMessageID []byte             `json:"last_read_message_id"`
+	UnreadCount       int32              `json:"unread_count"`
+	Username          string             `json:"username"`
+	Name              string             `json:"name"`
 }
 
-func (q *Queries) GetGroupMembersWithName(ctx context.Context, grpID []byte) ([]*GetGroupMembersWithNameRow, error) {
-	rows, err := q.db.Query(ctx, getGroupMembersWithName, grpID)
+// Returns the members of a group along with their names, the members are ordered by their id (newest users first)
+// query is a pattern that is matched against the name and the username (case insensitive)
+func (q *Queries) GetGroupMembersWithName(ctx context.Context, arg GetGroupMembersWithNameParams) ([]*GetGroupMembersWithNameRow, error) {
+	rows, err := q.db.Query(ctx, getGroupMembersWithName,
+		arg.GrpID,
+		arg.Before,
+		arg.Query,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +257,8 @@ func (q *Queries) GetGroupMembersWithName(ctx context.Context, grpID []byte) ([]
 			&i.UsrID,
 			&i.Role,
 			&i.JoinedAt,
+			&i.LastReadMessageID,
+			&i.UnreadCount,
 			&i.Username,
 			&i.Name,
 		); err != nil {
@@ -121,7 +274,7 @@ func (q *Queries) GetGroupMembersWithName(ctx context.Context, grpID []byte) ([]
 
 const getGroupMemberships = `-- name: GetGroupMemberships :many
 
-SELECT grp_id, usr_id, role, joined_at FROM grp_membership
+SELECT grp_id, usr_id, role, joined_at, last_read_message_id, unread_count FROM grp_membership
 WHERE
 grp_id = $1
 `
@@ -141,6 +294,8 @@ func (q *Queries) GetGroupMemberships(ctx context.Context, grpID []byte) ([]*Grp
 			&i.UsrID,
 			&i.Role,
 			&i.JoinedAt,
+			&i.LastReadMessageID,
+			&i.UnreadCount,
 		); err != nil {
 			return nil, err
 		}
@@ -152,9 +307,39 @@ func (q *Queries) GetGroupMemberships(ctx context.Context, grpID []byte) ([]*Grp
 	return items, nil
 }
 
+const getMembership = `-- name: GetMembership :one
+
+SELECT grp_id, usr_id, role, joined_at, last_read_message_id, unread_count FROM grp_membership
+WHERE
+    grp_id = $1
+        AND
+    usr_id = $2
+LIMIT 1
+`
+
+type GetMembershipParams struct {
+	GrpID []byte `json:"grp_id"`
+	UsrID []byte `json:"usr_id"`
+}
+
+// Get the membership of a user in a group, used to check the role of the user
+func (q *Queries) GetMembership(ctx context.Context, arg GetMembershipParams) (*GrpMembership, error) {
+	row := q.db.QueryRow(ctx, getMembership, arg.GrpID, arg.UsrID)
+	var i GrpMembership
+	err := row.Scan(
+		&i.GrpID,
+		&i.UsrID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.LastReadMessageID,
+		&i.UnreadCount,
+	)
+	return &i, err
+}
+
 const getUserMemberships = `-- name: GetUserMemberships :many
 
-SELECT grp_id, usr_id, role, joined_at FROM grp_membership
+SELECT grp_id, usr_id, role, joined_at, last_read_message_id, unread_count FROM grp_membership
 WHERE
 usr_id = $1
 `
@@ -174,6 +359,8 @@ func (q *Queries) GetUserMemberships(ctx context.Context, usrID []byte) ([]*GrpM
 			&i.UsrID,
 			&i.Role,
 			&i.JoinedAt,
+			&i.LastReadMessageID,
+			&i.UnreadCount,
 		); err != nil {
 			return nil, err
 		}
@@ -184,3 +371,56 @@ func (q *Queries) GetUserMemberships(ctx context.Context, usrID []byte) ([]*GrpM
 	}
 	return items, nil
 }
+
+const incrementUnreadCounts = `-- name: IncrementUnreadCounts :exec
+
+UPDATE grp_membership
+SET unread_count = unread_count + 1
+WHERE
+    grp_id = $1
+        AND
+    usr_id <> $2
+`
+
+type IncrementUnreadCountsParams struct {
+	GrpID    []byte `json:"grp_id"`
+	SenderID []byte `json:"sender_id"`
+}
+
+// Counts a new message in the timeline of the group as unread for every member except its sender
+func (q *Queries) IncrementUnreadCounts(ctx context.Context, arg IncrementUnreadCountsParams) error {
+	_, err := q.db.Exec(ctx, incrementUnreadCounts, arg.GrpID, arg.SenderID)
+	return err
+}
+
+const updateMembershipRole = `-- name: UpdateMembershipRole :one
+
+UPDATE grp_membership
+SET role = $1
+WHERE
+    grp_id = $2
+        AND
+    usr_id = $3
+RETURNING grp_id, usr_id, role, joined_at, last_read_message_id, unread_count
+`
+
+type UpdateMembershipRoleParams struct {
+	Role  string `json:"role"`
+	GrpID []byte `json:"grp_id"`
+	UsrID []byte `json:"usr_id"`
+}
+
+// Change the role of a member
+func (q *Queries) UpdateMembershipRole(ctx context.Context, arg UpdateMembershipRoleParams) (*GrpMembership, error) {
+	row := q.db.QueryRow(ctx, updateMembershipRole, arg.Role, arg.GrpID, arg.UsrID)
+	var i GrpMembership
+	err := row.Scan(
+		&i.GrpID,
+		&i.UsrID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.LastReadMessageID,
+		&i.UnreadCount,
+	)
+	return &i, err
+}
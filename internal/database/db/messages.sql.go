@@ -7,20 +7,62 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addThreadReply = `-- name: AddThreadReply :one
+
+UPDATE message
+SET
+    reply_count = reply_count + 1,
+    last_reply_at = GREATEST(last_reply_at, $1::timestamptz)
+WHERE id = $2
+RETURNING reply_count, last_reply_at
+`
+
+type AddThreadReplyParams struct {
+	LastReplyAt pgtype.Timestamptz `json:"last_reply_at"`
+	ID          []byte             `json:"id"`
+}
+
+type AddThreadReplyRow struct {
+	ReplyCount  int32              `json:"reply_count"`
+	LastReplyAt pgtype.Timestamptz `json:"last_reply_at"`
+}
+
+// Updates the reply count and the time of the last reply of a thread after a reply has been added
+func (q *Queries) AddThreadReply(ctx context.Context, arg AddThreadReplyParams) (*AddThreadReplyRow, error) {
+	row := q.db.QueryRow(ctx, addThreadReply, arg.LastReplyAt, arg.ID)
+	var i AddThreadReplyRow
+	err := row.Scan(&i.ReplyCount, &i.LastReplyAt)
+	return &i, err
+}
+
 const createMessage = `-- name: CreateMessage :one
-INSERT INTO message (id, type, grp_id, content, sender_id)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, type, grp_id, created_at, content, sender_id
+INSERT INTO message (id, type, grp_id, content, sender_id, reply_to_id, thread_root_id, payload)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload
 `
 
 type CreateMessageParams struct {
-	ID       []byte `json:"id"`
-	Type     string `json:"type"`
-	GrpID    []byte `json:"grp_id"`
-	Content  string `json:"content"`
-	SenderID []byte `json:"sender_id"`
+	ID           []byte `json:"id"`
+	Type         string `json:"type"`
+	GrpID        []byte `json:"grp_id"`
+	Content      string `json:"content"`
+	SenderID     []byte `json:"sender_id"`
+	ReplyToID    []byte `json:"reply_to_id"`
+	ThreadRootID []byte `json:"thread_root_id"`
+	Payload      []byte `json:"payload"`
 }
 
 func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (*Message, error) {
@@ -30,6 +72,9 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (*
 		arg.GrpID,
 		arg.Content,
 		arg.SenderID,
+		arg.ReplyToID,
+		arg.ThreadRootID,
+		arg.Payload,
 	)
 	var i Message
 	err := row.Scan(
@@ -39,11 +84,36 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (*
 		&i.CreatedAt,
 		&i.Content,
 		&i.SenderID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ReplyToID,
+		&i.ThreadRootID,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+		&i.Payload,
 	)
 	return &i, err
 }
 
-const deleteMessage = `-- name: DeleteMessage :exec
+const createMessageRevision = `-- name: CreateMessageRevision :exec
+INSERT INTO message_revision (id, message_id, content)
+VALUES ($1, $2, $3)
+`
+
+type CreateMessageRevisionParams struct {
+	ID        []byte `json:"id"`
+	MessageID []byte `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+func (q *Queries) CreateMessageRevision(ctx context.Context, arg CreateMessageRevisionParams) error {
+	_, err := q.db.Exec(ctx, createMessageRevision, arg.ID, arg.MessageID, arg.Content)
+	return err
+}
+
+const deleteMessage = `-- name: DeleteMessage :execrows
+
 DELETE FROM message
 WHERE 
     id = $1
@@ -56,13 +126,27 @@ type DeleteMessageParams struct {
 	GrpID []byte `json:"grp_id"`
 }
 
-func (q *Queries) DeleteMessage(ctx context.Context, arg DeleteMessageParams) error {
-	_, err := q.db.Exec(ctx, deleteMessage, arg.ID, arg.GrpID)
+// Permanently deletes a message, the revisions of the message are deleted along with it
+func (q *Queries) DeleteMessage(ctx context.Context, arg DeleteMessageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMessage, arg.ID, arg.GrpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteMessageRevisions = `-- name: DeleteMessageRevisions :exec
+DELETE FROM message_revision
+WHERE message_id = $1
+`
+
+func (q *Queries) DeleteMessageRevisions(ctx context.Context, messageID []byte) error {
+	_, err := q.db.Exec(ctx, deleteMessageRevisions, messageID)
 	return err
 }
 
 const getMessage = `-- name: GetMessage :one
-SELECT id, type, grp_id, created_at, content, sender_id FROM message
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
 WHERE
     id = $1
         AND
@@ -85,14 +169,156 @@ func (q *Queries) GetMessage(ctx context.Context, arg GetMessageParams) (*Messag
 		&i.CreatedAt,
 		&i.Content,
 		&i.SenderID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ReplyToID,
+		&i.ThreadRootID,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+		&i.Payload,
 	)
 	return &i, err
 }
 
+const getMessageForUpdate = `-- name: GetMessageForUpdate :one
+
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    id = $1
+        AND
+    grp_id = $2
+LIMIT 1
+FOR UPDATE
+`
+
+type GetMessageForUpdateParams struct {
+	ID    []byte `json:"id"`
+	GrpID []byte `json:"grp_id"`
+}
+
+// Locks the message, so that concurrent edits of the same message are serialized
+func (q *Queries) GetMessageForUpdate(ctx context.Context, arg GetMessageForUpdateParams) (*Message, error) {
+	row := q.db.QueryRow(ctx, getMessageForUpdate, arg.ID, arg.GrpID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.GrpID,
+		&i.CreatedAt,
+		&i.Content,
+		&i.SenderID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ReplyToID,
+		&i.ThreadRootID,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+		&i.Payload,
+	)
+	return &i, err
+}
+
+const getMessagePreviews = `-- name: GetMessagePreviews :many
+
+SELECT
+    m.id,
+    m.grp_id,
+    m.sender_id,
+    u.name AS sender_name,
+    LEFT(m.content, 100)::text AS content,
+    m.type,
+    m.payload,
+    m.deleted_at
+FROM message AS m
+LEFT JOIN usr AS u
+ON m.sender_id = u.id
+WHERE m.id = ANY($1::bytea[])
+`
+
+type GetMessagePreviewsRow struct {
+	ID         []byte             `json:"id"`
+	GrpID      []byte             `json:"grp_id"`
+	SenderID   []byte             `json:"sender_id"`
+	SenderName pgtype.Text        `json:"sender_name"`
+	Content    string             `json:"content"`
+	Type       string             `json:"type"`
+	Payload    []byte             `json:"payload"`
+	DeletedAt  pgtype.Timestamptz `json:"deleted_at"`
+}
+
+// Returns a compact preview of the given messages, which is embedded in the replies to these messages. The sender is NULL
+// for system messages
+func (q *Queries) GetMessagePreviews(ctx context.Context, ids [][]byte) ([]*GetMessagePreviewsRow, error) {
+	rows, err := q.db.Query(ctx, getMessagePreviews, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetMessagePreviewsRow
+	for rows.Next() {
+		var i GetMessagePreviewsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.GrpID,
+			&i.SenderID,
+			&i.SenderName,
+			&i.Content,
+			&i.Type,
+			&i.Payload,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessageRevisions = `-- name: GetMessageRevisions :many
+
+SELECT id, message_id, content, replaced_at FROM message_revision
+WHERE message_id = $1
+ORDER BY id DESC
+`
+
+// Returns the previous versions of a message, newest first
+func (q *Queries) GetMessageRevisions(ctx context.Context, messageID []byte) ([]*MessageRevision, error) {
+	rows, err := q.db.Query(ctx, getMessageRevisions, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*MessageRevision
+	for rows.Next() {
+		var i MessageRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Content,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMessagesInGroup = `-- name: GetMessagesInGroup :many
-SELECT id, type, grp_id, created_at, content, sender_id FROM message
+
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
 WHERE
     grp_id = $1
+AND
+    thread_root_id IS NULL
 AND
     ($2::bytea IS NULL OR id < $2::bytea)
 ORDER BY id DESC
@@ -105,6 +331,7 @@ type GetMessagesInGroupParams struct {
 	Limit  int32  `json:"limit"`
 }
 
+// Returns the timeline of a group, replies in threads are not part of the timeline
 func (q *Queries) GetMessagesInGroup(ctx context.Context, arg GetMessagesInGroupParams) ([]*Message, error) {
 	rows, err := q.db.Query(ctx, getMessagesInGroup, arg.GrpID, arg.Before, arg.Limit)
 	if err != nil {
@@ -121,6 +348,14 @@ func (q *Queries) GetMessagesInGroup(ctx context.Context, arg GetMessagesInGroup
 			&i.CreatedAt,
 			&i.Content,
 			&i.SenderID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ReplyToID,
+			&i.ThreadRootID,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+			&i.Payload,
 		); err != nil {
 			return nil, err
 		}
@@ -131,3 +366,375 @@ func (q *Queries) GetMessagesInGroup(ctx context.Context, arg GetMessagesInGroup
 	}
 	return items, nil
 }
+
+const getMessagesInGroupAfter = `-- name: GetMessagesInGroupAfter :many
+
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    grp_id = $1
+AND
+    thread_root_id IS NULL
+AND
+    id > $2
+ORDER BY id ASC
+LIMIT $3
+`
+
+type GetMessagesInGroupAfterParams struct {
+	GrpID []byte `json:"grp_id"`
+	After []byte `json:"after"`
+	Limit int32  `json:"limit"`
+}
+
+// Returns the messages of the timeline after the given message, oldest first, so that the messages closest to it are returned
+func (q *Queries) GetMessagesInGroupAfter(ctx context.Context, arg GetMessagesInGroupAfterParams) ([]*Message, error) {
+	rows, err := q.db.Query(ctx, getMessagesInGroupAfter, arg.GrpID, arg.After, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.GrpID,
+			&i.CreatedAt,
+			&i.Content,
+			&i.SenderID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ReplyToID,
+			&i.ThreadRootID,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getThreadMessages = `-- name: GetThreadMessages :many
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    thread_root_id = $1
+AND
+    grp_id = $2
+AND
+    ($3::bytea IS NULL OR id < $3::bytea)
+ORDER BY id DESC
+LIMIT $4
+`
+
+type GetThreadMessagesParams struct {
+	ThreadRootID []byte `json:"thread_root_id"`
+	GrpID        []byte `json:"grp_id"`
+	Before       []byte `json:"before"`
+	Limit        int32  `json:"limit"`
+}
+
+func (q *Queries) GetThreadMessages(ctx context.Context, arg GetThreadMessagesParams) ([]*Message, error) {
+	rows, err := q.db.Query(ctx, getThreadMessages,
+		arg.ThreadRootID,
+		arg.GrpID,
+		arg.Before,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.GrpID,
+			&i.CreatedAt,
+			&i.Content,
+			&i.SenderID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ReplyToID,
+			&i.ThreadRootID,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hasMessagesInGroupFrom = `-- name: HasMessagesInGroupFrom :one
+
+SELECT EXISTS(
+    SELECT 1 FROM message
+    WHERE
+        grp_id = $1
+    AND
+        thread_root_id IS NULL
+    AND
+        id >= $2
+) AS exists
+`
+
+type HasMessagesInGroupFromParams struct {
+	GrpID []byte `json:"grp_id"`
+	From  []byte `json:"from"`
+}
+
+// Checks if the timeline has messages with id greater than or equal to the given id
+func (q *Queries) HasMessagesInGroupFrom(ctx context.Context, arg HasMessagesInGroupFromParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasMessagesInGroupFrom, arg.GrpID, arg.From)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const hasMessagesInGroupUpTo = `-- name: HasMessagesInGroupUpTo :one
+
+SELECT EXISTS(
+    SELECT 1 FROM message
+    WHERE
+        grp_id = $1
+    AND
+        thread_root_id IS NULL
+    AND
+        id <= $2
+) AS exists
+`
+
+type HasMessagesInGroupUpToParams struct {
+	GrpID []byte `json:"grp_id"`
+	UpTo  []byte `json:"up_to"`
+}
+
+// Checks if the timeline has messages with id less than or equal to the given id
+func (q *Queries) HasMessagesInGroupUpTo(ctx context.Context, arg HasMessagesInGroupUpToParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasMessagesInGroupUpTo, arg.GrpID, arg.UpTo)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const refreshThread = `-- name: RefreshThread :exec
+
+UPDATE message
+SET
+    reply_count = (SELECT COUNT(*) FROM message AS r WHERE r.thread_root_id = $1 AND r.deleted_at IS NULL),
+    last_reply_at = (SELECT MAX(r.created_at) FROM message AS r WHERE r.thread_root_id = $1 AND r.deleted_at IS NULL)
+WHERE message.id = $1
+`
+
+// Recomputes the reply count and the time of the last reply of a thread after a reply has been deleted, deleted replies are
+// not counted
+func (q *Queries) RefreshThread(ctx context.Context, id []byte) error {
+	_, err := q.db.Exec(ctx, refreshThread, id)
+	return err
+}
+
+const searchMessages = `-- name: SearchMessages :many
+
+SELECT
+    m.id,
+    m.type,
+    m.grp_id,
+    m.created_at,
+    m.sender_id,
+    m.thread_root_id,
+    g.name AS grp_name,
+    u.name AS sender_name,
+    ts_headline('english', replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), websearch_to_tsquery('english', $1::text), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')::text AS snippet
+FROM message AS m
+INNER JOIN grp_membership AS mem
+    ON mem.grp_id = m.grp_id AND mem.usr_id = $2
+INNER JOIN grp AS g
+    ON g.id = m.grp_id
+INNER JOIN usr AS u
+    ON u.id = m.sender_id
+WHERE
+    m.content_tsv @@ websearch_to_tsquery('english', $1::text)
+AND
+    m.deleted_at IS NULL
+AND
+    ($3::bytea IS NULL OR m.grp_id = $3::bytea)
+AND
+    ($4::bytea IS NULL OR m.sender_id = $4::bytea)
+AND
+    ($5::timestamptz IS NULL OR m.created_at >= $5::timestamptz)
+AND
+    ($6::timestamptz IS NULL OR m.created_at < $6::timestamptz)
+AND
+    ($7::text IS NULL OR m.type = $7::text)
+AND
+    ($8::bytea IS NULL OR m.id < $8::bytea)
+ORDER BY m.id DESC
+LIMIT $9
+`
+
+type SearchMessagesParams struct {
+	Query    string             `json:"query"`
+	UsrID    []byte             `json:"usr_id"`
+	GrpID    []byte             `json:"grp_id"`
+	SenderID []byte             `json:"sender_id"`
+	Since    pgtype.Timestamptz `json:"since"`
+	Until    pgtype.Timestamptz `json:"until"`
+	Type     pgtype.Text        `json:"type"`
+	Before   []byte             `json:"before"`
+	Limit    int32              `json:"limit"`
+}
+
+type SearchMessagesRow struct {
+	ID           []byte             `json:"id"`
+	Type         string             `json:"type"`
+	GrpID        []byte             `json:"grp_id"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	SenderID     []byte             `json:"sender_id"`
+	ThreadRootID []byte             `json:"thread_root_id"`
+	GrpName      string             `json:"grp_name"`
+	SenderName   string             `json:"sender_name"`
+	Snippet      string             `json:"snippet"`
+}
+
+// Full text search over the messages of the groups the user is a member of, newest first. The content is HTML escaped before
+// it is highlighted, so the snippet is safe to render as HTML, and the only tags in it are the <mark> tags around the matching words
+func (q *Queries) SearchMessages(ctx context.Context, arg SearchMessagesParams) ([]*SearchMessagesRow, error) {
+	rows, err := q.db.Query(ctx, searchMessages,
+		arg.Query,
+		arg.UsrID,
+		arg.GrpID,
+		arg.SenderID,
+		arg.Since,
+		arg.Until,
+		arg.Type,
+		arg.Before,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*SearchMessagesRow
+	for rows.Next() {
+		var i SearchMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.GrpID,
+			&i.CreatedAt,
+			&i.SenderID,
+			&i.ThreadRootID,
+			&i.GrpName,
+			&i.SenderName,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteMessage = `-- name: SoftDeleteMessage :one
+
+UPDATE message
+SET
+    content = '',
+    payload = '{}'::jsonb,
+    deleted_at = NOW(),
+    deleted_by = $1
+WHERE
+    id = $2
+        AND
+    grp_id = $3
+        AND
+    deleted_at IS NULL
+RETURNING id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload
+`
+
+type SoftDeleteMessageParams struct {
+	DeletedBy []byte `json:"deleted_by"`
+	ID        []byte `json:"id"`
+	GrpID     []byte `json:"grp_id"`
+}
+
+// Marks a message as deleted and clears its content, the message is kept as a tombstone. Messages that have already been
+// deleted are not modified
+func (q *Queries) SoftDeleteMessage(ctx context.Context, arg SoftDeleteMessageParams) (*Message, error) {
+	row := q.db.QueryRow(ctx, softDeleteMessage, arg.DeletedBy, arg.ID, arg.GrpID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.GrpID,
+		&i.CreatedAt,
+		&i.Content,
+		&i.SenderID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ReplyToID,
+		&i.ThreadRootID,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+		&i.Payload,
+	)
+	return &i, err
+}
+
+const updateMessageContent = `-- name: UpdateMessageContent :one
+UPDATE message
+SET
+    content = $1,
+    payload = $2,
+    edited_at = NOW()
+WHERE id = $3
+RETURNING id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload
+`
+
+type UpdateMessageContentParams struct {
+	Content string `json:"content"`
+	Payload []byte `json:"payload"`
+	ID      []byte `json:"id"`
+}
+
+func (q *Queries) UpdateMessageContent(ctx context.Context, arg UpdateMessageContentParams) (*Message, error) {
+	row := q.db.QueryRow(ctx, updateMessageContent, arg.Content, arg.Payload, arg.ID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.GrpID,
+		&i.CreatedAt,
+		&i.Content,
+		&i.SenderID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ReplyToID,
+		&i.ThreadRootID,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+		&i.Payload,
+	)
+	return &i, err
+}
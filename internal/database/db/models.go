@@ -8,28 +8,137 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Grp struct {
-	Name        string             `json:"name"`
-	Description string             `json:"description"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+type Attachment struct {
 	ID          []byte             `json:"id"`
-	OwnerID     []byte             `json:"owner_id"`
+	GrpID       []byte             `json:"grp_id"`
+	UploaderID  []byte             `json:"uploader_id"`
+	MessageID   []byte             `json:"message_id"`
+	Filename    string             `json:"filename"`
+	ContentType string             `json:"content_type"`
+	Size        int64              `json:"size"`
+	StorageKey  string             `json:"storage_key"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 }
 
-type GrpMembership struct {
-	GrpID    []byte             `json:"grp_id"`
-	UsrID    []byte             `json:"usr_id"`
-	Role     string             `json:"role"`
-	JoinedAt pgtype.Timestamptz `json:"joined_at"`
+type BlobDeletion struct {
+	StorageKey string             `json:"storage_key"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
 }
 
-type Message struct {
+type Grp struct {
+	Name          string             `json:"name"`
+	Description   string             `json:"description"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	ID            []byte             `json:"id"`
+	OwnerID       []byte             `json:"owner_id"`
+	Kind          string             `json:"kind"`
+	DmPair        []byte             `json:"dm_pair"`
+	Visibility    string             `json:"visibility"`
+	LastMessageID []byte             `json:"last_message_id"`
+	LastMessageAt pgtype.Timestamptz `json:"last_message_at"`
+	MessageCount  int64              `json:"message_count"`
+}
+
+type GrpBan struct {
+	GrpID     []byte             `json:"grp_id"`
+	UsrID     []byte             `json:"usr_id"`
+	Reason    string             `json:"reason"`
+	BannedBy  []byte             `json:"banned_by"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+type GrpInvite struct {
 	ID        []byte             `json:"id"`
-	Type      string             `json:"type"`
 	GrpID     []byte             `json:"grp_id"`
+	Code      string             `json:"code"`
+	CreatedBy []byte             `json:"created_by"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	MaxUses   pgtype.Int4        `json:"max_uses"`
+	UseCount  int32              `json:"use_count"`
+	Revoked   bool               `json:"revoked"`
+}
+
+type GrpJoinRequest struct {
+	GrpID     []byte             `json:"grp_id"`
+	UsrID     []byte             `json:"usr_id"`
+	Message   string             `json:"message"`
+	Status    string             `json:"status"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	DecidedAt pgtype.Timestamptz `json:"decided_at"`
+	DecidedBy []byte             `json:"decided_by"`
+}
+
+type GrpMembership struct {
+	GrpID             []byte             `json:"grp_id"`
+	UsrID             []byte             `json:"usr_id"`
+	Role              string             `json:"role"`
+	JoinedAt          pgtype.Timestamptz `json:"joined_at"`
+	LastReadMessageID []byte             `json:"last_read_message_id"`
+	UnreadCount       int32              `json:"unread_count"`
+}
+
+type Message struct {
+	ID           []byte             `json:"id"`
+	Type         string             `json:"type"`
+	GrpID        []byte             `json:"grp_id"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	Content      string             `json:"content"`
+	SenderID     []byte             `json:"sender_id"`
+	EditedAt     pgtype.Timestamptz `json:"edited_at"`
+	DeletedAt    pgtype.Timestamptz `json:"deleted_at"`
+	DeletedBy    []byte             `json:"deleted_by"`
+	ReplyToID    []byte             `json:"reply_to_id"`
+	ThreadRootID []byte             `json:"thread_root_id"`
+	ReplyCount   int32              `json:"reply_count"`
+	LastReplyAt  pgtype.Timestamptz `json:"last_reply_at"`
+	Payload      []byte             `json:"payload"`
+}
+
+type MessageMention struct {
+	MessageID   []byte `json:"message_id"`
+	UsrID       []byte `json:"usr_id"`
+	StartOffset int32  `json:"start_offset"`
+	Length      int32  `json:"length"`
+}
+
+type MessageReaction struct {
+	MessageID []byte             `json:"message_id"`
+	UsrID     []byte             `json:"usr_id"`
+	Emoji     string             `json:"emoji"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	Content   string             `json:"content"`
-	SenderID  []byte             `json:"sender_id"`
+}
+
+type MessageRevision struct {
+	ID         []byte             `json:"id"`
+	MessageID  []byte             `json:"message_id"`
+	Content    string             `json:"content"`
+	ReplacedAt pgtype.Timestamptz `json:"replaced_at"`
+}
+
+type MessageStatus struct {
+	MessageID []byte             `json:"message_id"`
+	UsrID     []byte             `json:"usr_id"`
+	Status    string             `json:"status"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+type ModerationLog struct {
+	ID          []byte             `json:"id"`
+	GrpID       []byte             `json:"grp_id"`
+	ActorID     []byte             `json:"actor_id"`
+	Action      string             `json:"action"`
+	MessageID   []byte             `json:"message_id"`
+	TargetUsrID []byte             `json:"target_usr_id"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type PollVote struct {
+	MessageID   []byte             `json:"message_id"`
+	UsrID       []byte             `json:"usr_id"`
+	OptionIndex int16              `json:"option_index"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 }
 
 type Token struct {
@@ -0,0 +1,5 @@
+ALTER TABLE grp_membership
+DROP CONSTRAINT IF EXISTS chk_grp_membership_role;
+
+UPDATE grp_membership
+SET role = 'member';
\ No newline at end of file
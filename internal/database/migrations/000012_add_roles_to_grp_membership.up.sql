@@ -0,0 +1,12 @@
+-- The user who owns the group gets the 'owner' role, everybody else stays a member
+UPDATE grp_membership AS mem
+SET role = 'owner'
+FROM grp AS g
+WHERE
+    g.id = mem.grp_id
+        AND
+    g.owner_id = mem.usr_id;
+
+ALTER TABLE grp_membership
+ADD CONSTRAINT chk_grp_membership_role
+CHECK (role IN ('owner', 'admin', 'member'));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_grp_invite_grp_id;
+
+DROP TABLE IF EXISTS grp_invite;
\ No newline at end of file
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS grp_invite (
+    -- ID of the invite, used to manage (list/revoke) the invite
+    id BYTEA NOT NULL CHECK(length(id) = 16),
+    -- The group to which the invite grants access
+    grp_id BYTEA NOT NULL CHECK(length(grp_id) = 16),
+    -- Random, unguessable code which is shared in the invite link
+    code TEXT NOT NULL,
+    -- The user who created the invite
+    created_by BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- The invite cannot be used after this time, NULL if the invite never expires
+    expires_at TIMESTAMP WITH TIME ZONE,
+    -- Maximum number of times the invite can be used, NULL if there is no limit
+    max_uses INTEGER CHECK(max_uses > 0),
+    -- Number of times the invite has been used
+    use_count INTEGER NOT NULL DEFAULT 0,
+    revoked BOOL NOT NULL DEFAULT FALSE,
+
+    CONSTRAINT Pk_grp_invite PRIMARY KEY (id),
+    CONSTRAINT Uk_grp_invite_code UNIQUE (code),
+    CONSTRAINT Fk_grp_invite_grp FOREIGN KEY (grp_id) REFERENCES grp(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_grp_invite_created_by FOREIGN KEY (created_by) REFERENCES usr(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_grp_invite_grp_id ON grp_invite(grp_id);
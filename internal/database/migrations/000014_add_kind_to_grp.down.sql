@@ -0,0 +1,8 @@
+ALTER TABLE grp
+DROP CONSTRAINT IF EXISTS uk_grp_dm_pair;
+
+ALTER TABLE grp
+DROP COLUMN IF EXISTS dm_pair;
+
+ALTER TABLE grp
+DROP COLUMN IF EXISTS kind;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- A group can either be a normal group, or a direct (1:1) conversation between two users
+ALTER TABLE grp
+ADD COLUMN kind TEXT NOT NULL DEFAULT 'group'
+CONSTRAINT chk_grp_kind CHECK (kind IN ('group', 'direct'));
+
+-- For direct conversations, the ids of both the users (in sorted order) concatenated together, NULL for groups.
+-- The unique constraint makes sure that there is exactly one direct conversation between a pair of users
+ALTER TABLE grp
+ADD COLUMN dm_pair BYTEA
+CONSTRAINT chk_grp_dm_pair CHECK (dm_pair IS NULL OR length(dm_pair) = 32);
+
+ALTER TABLE grp
+ADD CONSTRAINT uk_grp_dm_pair UNIQUE (dm_pair);
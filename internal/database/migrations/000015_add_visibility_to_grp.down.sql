@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_grp_public_id_desc;
+
+ALTER TABLE grp
+DROP COLUMN IF EXISTS visibility;
\ No newline at end of file
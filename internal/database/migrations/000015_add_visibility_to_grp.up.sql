@@ -0,0 +1,12 @@
+-- public: listed in the directory, anyone can join
+-- unlisted: not listed in the directory, anyone who knows the id can join
+-- private: not listed in the directory, users can only join through an invite or after their request is approved
+ALTER TABLE grp
+ADD COLUMN visibility TEXT NOT NULL DEFAULT 'unlisted'
+CONSTRAINT chk_grp_visibility CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+-- Direct conversations can never be joined by anyone else
+UPDATE grp SET visibility = 'private' WHERE kind = 'direct';
+
+-- Makes it quicker to page through the directory of public groups
+CREATE INDEX IF NOT EXISTS idx_grp_public_id_desc ON grp(id DESC) WHERE visibility = 'public';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_grp_join_request_pending;
+
+DROP TABLE IF EXISTS grp_join_request;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS grp_join_request (
+    grp_id BYTEA NOT NULL,
+    -- The user who wants to join the group
+    usr_id BYTEA NOT NULL,
+    -- Optional message to the admins of the group
+    message TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- Time at which the request was approved or rejected, and the admin who did it
+    decided_at TIMESTAMP WITH TIME ZONE,
+    decided_by BYTEA,
+
+    CONSTRAINT Pk_grp_join_request PRIMARY KEY (grp_id, usr_id),
+    CONSTRAINT chk_grp_join_request_status CHECK (status IN ('pending', 'approved', 'rejected')),
+    CONSTRAINT Fk_grp_join_request_grp FOREIGN KEY (grp_id) REFERENCES grp(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_grp_join_request_usr FOREIGN KEY (usr_id) REFERENCES usr(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_grp_join_request_decided_by FOREIGN KEY (decided_by) REFERENCES usr(id) ON DELETE SET NULL
+);
+
+-- Makes it quicker to list the pending requests of a group
+CREATE INDEX IF NOT EXISTS idx_grp_join_request_pending ON grp_join_request(grp_id, created_at) WHERE status = 'pending';
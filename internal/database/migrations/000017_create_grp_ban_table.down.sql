@@ -0,0 +1 @@
+DROP TABLE IF EXISTS grp_ban;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS grp_ban (
+    grp_id BYTEA NOT NULL,
+    -- The user who is banned from the group
+    usr_id BYTEA NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    -- The user who banned the user, NULL if that user has been deleted
+    banned_by BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- The ban is lifted after this time, NULL if the ban is permanent
+    expires_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT Pk_grp_ban PRIMARY KEY (grp_id, usr_id),
+    CONSTRAINT Fk_grp_ban_grp FOREIGN KEY (grp_id) REFERENCES grp(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_grp_ban_usr FOREIGN KEY (usr_id) REFERENCES usr(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_grp_ban_banned_by FOREIGN KEY (banned_by) REFERENCES usr(id) ON DELETE SET NULL
+);
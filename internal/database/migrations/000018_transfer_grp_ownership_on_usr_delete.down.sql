@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS trg_usr_transfer_grp_ownership ON usr;
+
+DROP FUNCTION IF EXISTS transfer_grp_ownership_on_usr_delete();
+
+ALTER TABLE grp
+DROP CONSTRAINT IF EXISTS fk_grp_owner_id;
+
+ALTER TABLE grp
+ADD CONSTRAINT fk_grp_owner_id
+FOREIGN KEY (owner_id) REFERENCES usr(id)
+ON DELETE CASCADE;
\ No newline at end of file
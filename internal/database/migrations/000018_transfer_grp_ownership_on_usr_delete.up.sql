@@ -0,0 +1,47 @@
+-- Deleting the owner of a group should not delete the group along with its history, instead the ownership is passed
+-- to the longest standing admin, or the longest standing member if there are no admins. Groups without any other
+-- member are deleted since nobody can access them anymore
+ALTER TABLE grp
+DROP CONSTRAINT IF EXISTS fk_grp_owner_id;
+
+ALTER TABLE grp
+ADD CONSTRAINT fk_grp_owner_id
+FOREIGN KEY (owner_id) REFERENCES usr(id)
+ON DELETE RESTRICT;
+
+CREATE OR REPLACE FUNCTION transfer_grp_ownership_on_usr_delete() RETURNS TRIGGER AS $$
+BEGIN
+    WITH successor AS (
+        SELECT DISTINCT ON (m.grp_id) m.grp_id, m.usr_id
+        FROM grp_membership AS m
+        INNER JOIN grp AS g
+        ON m.grp_id = g.id
+        WHERE
+            g.owner_id = OLD.id
+                AND
+            m.usr_id <> OLD.id
+        ORDER BY m.grp_id, (m.role = 'admin') DESC, m.joined_at, m.usr_id
+    ), transferred AS (
+        UPDATE grp AS g
+        SET owner_id = s.usr_id
+        FROM successor AS s
+        WHERE g.id = s.grp_id
+        RETURNING g.id, g.owner_id
+    )
+    UPDATE grp_membership AS m
+    SET role = 'owner'
+    FROM transferred AS t
+    WHERE
+        m.grp_id = t.id
+            AND
+        m.usr_id = t.owner_id;
+
+    DELETE FROM grp WHERE owner_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_usr_transfer_grp_ownership
+BEFORE DELETE ON usr
+FOR EACH ROW
+EXECUTE FUNCTION transfer_grp_ownership_on_usr_delete();
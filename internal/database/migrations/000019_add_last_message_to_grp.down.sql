@@ -0,0 +1,4 @@
+ALTER TABLE grp
+DROP COLUMN IF EXISTS message_count,
+DROP COLUMN IF EXISTS last_message_at,
+DROP COLUMN IF EXISTS last_message_id;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- The last message and the number of messages of a group are stored in the group, so that the list of groups
+-- does not have to scan the message table. They are updated in the same transaction as the message is created or deleted
+ALTER TABLE grp
+ADD COLUMN last_message_id BYTEA,
+ADD COLUMN last_message_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN message_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE grp AS g
+SET
+    last_message_id = lm.id,
+    last_message_at = lm.created_at,
+    message_count = lm.message_count
+FROM (
+    SELECT DISTINCT ON (grp_id)
+        grp_id,
+        id,
+        created_at,
+        COUNT(*) OVER (PARTITION BY grp_id) AS message_count
+    FROM message
+    ORDER BY grp_id, id DESC
+) AS lm
+WHERE lm.grp_id = g.id;
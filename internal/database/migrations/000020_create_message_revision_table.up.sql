@@ -0,0 +1,17 @@
+ALTER TABLE message
+ADD COLUMN edited_at TIMESTAMP WITH TIME ZONE;
+
+-- Stores the previous versions of a message, a revision is created every time the message is edited
+CREATE TABLE IF NOT EXISTS message_revision (
+    id BYTEA NOT NULL CHECK(length(id) = 16),
+    message_id BYTEA NOT NULL,
+    -- Content of the message before the edit
+    content TEXT NOT NULL,
+    -- Time at which this content was replaced by the edit
+    replaced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_message_revision PRIMARY KEY (id),
+    CONSTRAINT Fk_message_revision_message FOREIGN KEY (message_id) REFERENCES message(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_revision_message_id ON message_revision(message_id, id DESC);
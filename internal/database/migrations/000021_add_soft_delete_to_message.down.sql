@@ -0,0 +1,6 @@
+ALTER TABLE message
+DROP CONSTRAINT IF EXISTS fk_message_deleted_by;
+
+ALTER TABLE message
+DROP COLUMN IF EXISTS deleted_by,
+DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- Deleted messages are kept as tombstones, the content is cleared when the message is deleted
+ALTER TABLE message
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN deleted_by BYTEA;
+
+ALTER TABLE message
+ADD CONSTRAINT fk_message_deleted_by
+FOREIGN KEY (deleted_by) REFERENCES usr(id)
+ON DELETE SET NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS moderation_log;
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- Records the moderation actions taken in a group, such as the deletion of a message of another member
+CREATE TABLE IF NOT EXISTS moderation_log (
+    id BYTEA NOT NULL CHECK(length(id) = 16),
+    grp_id BYTEA NOT NULL,
+    -- The user who performed the action, NULL if the user has been deleted
+    actor_id BYTEA,
+    -- The action that was performed, message_deleted or message_purged
+    action TEXT NOT NULL,
+    -- The message the action was performed on, there is no foreign key since purged messages no longer exist
+    message_id BYTEA,
+    -- The user the action was performed on (the sender of the message), NULL if the user has been deleted
+    target_usr_id BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_moderation_log PRIMARY KEY (id),
+    CONSTRAINT Fk_moderation_log_grp FOREIGN KEY (grp_id) REFERENCES grp(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_moderation_log_actor FOREIGN KEY (actor_id) REFERENCES usr(id) ON DELETE SET NULL,
+    CONSTRAINT Fk_moderation_log_target_usr FOREIGN KEY (target_usr_id) REFERENCES usr(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_log_grp_id_id_desc ON moderation_log(grp_id, id DESC);
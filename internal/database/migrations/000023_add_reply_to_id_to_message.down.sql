@@ -0,0 +1,5 @@
+ALTER TABLE message
+DROP CONSTRAINT IF EXISTS fk_message_reply_to_id;
+
+ALTER TABLE message
+DROP COLUMN IF EXISTS reply_to_id;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- The message this message is a reply to, it always belongs to the same group
+ALTER TABLE message
+ADD COLUMN reply_to_id BYTEA;
+
+ALTER TABLE message
+ADD CONSTRAINT fk_message_reply_to_id
+FOREIGN KEY (reply_to_id) REFERENCES message(id)
+ON DELETE SET NULL;
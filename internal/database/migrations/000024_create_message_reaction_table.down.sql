@@ -0,0 +1 @@
+DROP TABLE IF EXISTS message_reaction;
\ No newline at end of file
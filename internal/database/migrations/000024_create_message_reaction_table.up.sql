@@ -0,0 +1,11 @@
+-- Emoji reactions of users to messages, a user can react to a message with multiple emojis, but only once with each emoji
+CREATE TABLE IF NOT EXISTS message_reaction (
+    message_id BYTEA NOT NULL,
+    usr_id BYTEA NOT NULL,
+    emoji TEXT NOT NULL CHECK(length(emoji) BETWEEN 1 AND 32),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_message_reaction PRIMARY KEY (message_id, usr_id, emoji),
+    CONSTRAINT Fk_message_reaction_message FOREIGN KEY (message_id) REFERENCES message(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_message_reaction_usr FOREIGN KEY (usr_id) REFERENCES usr(id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_message_thread_root_id;
+
+ALTER TABLE message
+DROP CONSTRAINT IF EXISTS fk_message_thread_root_id;
+
+ALTER TABLE message
+DROP COLUMN IF EXISTS last_reply_at,
+DROP COLUMN IF EXISTS reply_count,
+DROP COLUMN IF EXISTS thread_root_id;
\ No newline at end of file
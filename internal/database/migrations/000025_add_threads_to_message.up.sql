@@ -0,0 +1,14 @@
+-- A message can start a thread, replies in a thread are not shown in the timeline of the group. The root of the thread keeps
+-- the number of replies and the time of the last reply, so that they can be shown without scanning the thread
+ALTER TABLE message
+ADD COLUMN thread_root_id BYTEA,
+ADD COLUMN reply_count INT NOT NULL DEFAULT 0,
+ADD COLUMN last_reply_at TIMESTAMP WITH TIME ZONE;
+
+-- The replies in a thread are removed along with the root of the thread
+ALTER TABLE message
+ADD CONSTRAINT fk_message_thread_root_id
+FOREIGN KEY (thread_root_id) REFERENCES message(id)
+ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_message_thread_root_id ON message(thread_root_id, id DESC) WHERE thread_root_id IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS message_status;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Delivery and read receipts of messages, a row is stored for each member (other than the sender) who has received or read the
+-- message. The status only moves forward, from delivered to read
+CREATE TABLE IF NOT EXISTS message_status (
+    message_id BYTEA NOT NULL,
+    usr_id BYTEA NOT NULL,
+    status TEXT NOT NULL CHECK(status IN ('delivered', 'read')),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_message_status PRIMARY KEY (message_id, usr_id),
+    CONSTRAINT Fk_message_status_message FOREIGN KEY (message_id) REFERENCES message(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_message_status_usr FOREIGN KEY (usr_id) REFERENCES usr(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_status_usr_id ON message_status(usr_id);
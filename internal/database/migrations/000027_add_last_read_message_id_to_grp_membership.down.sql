@@ -0,0 +1,2 @@
+ALTER TABLE grp_membership
+DROP COLUMN IF EXISTS last_read_message_id;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- The last message in the timeline of the group that the member has read, messages after it are unread. If it is NULL, messages
+-- sent after the member joined the group are unread. It is not a foreign key, since the message can be purged
+ALTER TABLE grp_membership
+ADD COLUMN last_read_message_id BYTEA;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_message_content_tsv;
+
+ALTER TABLE message
+DROP COLUMN IF EXISTS content_tsv;
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- Full text search over the content of messages, the search vector is kept up to date by postgres. Queries on the message
+-- table list their columns explicitly, so that the search vector is never fetched
+ALTER TABLE message
+ADD COLUMN content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_message_content_tsv ON message USING GIN (content_tsv);
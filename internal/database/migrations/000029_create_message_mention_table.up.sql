@@ -0,0 +1,14 @@
+-- Users mentioned in messages with @username, a row is stored for each mention in the content. The mention spans length
+-- characters (unicode code points) of the content, from start_offset
+CREATE TABLE IF NOT EXISTS message_mention (
+    message_id BYTEA NOT NULL,
+    usr_id BYTEA NOT NULL,
+    start_offset INT NOT NULL,
+    length INT NOT NULL,
+
+    CONSTRAINT Pk_message_mention PRIMARY KEY (message_id, start_offset),
+    CONSTRAINT Fk_message_mention_message FOREIGN KEY (message_id) REFERENCES message(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_message_mention_usr FOREIGN KEY (usr_id) REFERENCES usr(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mention_usr_id ON message_mention(usr_id, message_id);
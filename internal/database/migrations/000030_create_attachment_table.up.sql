@@ -0,0 +1,20 @@
+-- Files uploaded to a group, the contents are kept in a blob store under storage_key. An attachment is uploaded first, and
+-- then referenced by a message of type file or image, message_id is NULL until then
+CREATE TABLE IF NOT EXISTS attachment (
+    id BYTEA NOT NULL CHECK(length(id) = 16),
+    grp_id BYTEA NOT NULL,
+    uploader_id BYTEA NOT NULL,
+    message_id BYTEA,
+    filename TEXT NOT NULL CHECK(length(filename) BETWEEN 1 AND 255),
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL CHECK(size >= 0),
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_attachment PRIMARY KEY (id),
+    CONSTRAINT Fk_attachment_grp FOREIGN KEY (grp_id) REFERENCES grp(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_attachment_uploader FOREIGN KEY (uploader_id) REFERENCES usr(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_attachment_message FOREIGN KEY (message_id) REFERENCES message(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_message_id ON attachment(message_id) WHERE message_id IS NOT NULL;
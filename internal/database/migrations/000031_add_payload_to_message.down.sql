@@ -0,0 +1,2 @@
+ALTER TABLE message
+DROP COLUMN IF EXISTS payload;
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- The structured payload of a message, its schema depends on the type of the message. The text of the payload is also kept
+-- in content, so that messages can be searched without decoding the payload
+ALTER TABLE message
+ADD COLUMN payload JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- Encodes an id as a ULID string (Crockford's base32), the 128 bits are split into 26 groups of 5 bits from the left, with
+-- two zero bits in front. get_bit numbers the bits of each byte from the least significant bit
+CREATE FUNCTION pg_temp.ulid_to_text(id BYTEA) RETURNS TEXT
+LANGUAGE SQL IMMUTABLE AS $$
+    SELECT string_agg(substr('0123456789ABCDEFGHJKMNPQRSTVWXYZ', 1 + c.v::int, 1), '' ORDER BY i)
+    FROM generate_series(0, 25) AS i
+    CROSS JOIN LATERAL (
+        SELECT sum(get_bit(id, (q / 8) * 8 + 7 - q % 8) << (5 * i + 2 - q)) AS v
+        FROM generate_series(greatest(5 * i - 2, 0), 5 * i + 2) AS q
+    ) AS c
+$$;
+
+UPDATE message
+SET payload = jsonb_build_object('content', content)
+WHERE deleted_at IS NULL AND type = 'text';
+
+UPDATE message AS m
+SET payload = jsonb_build_object(
+    'content', m.content,
+    'attachment_ids', (
+        SELECT COALESCE(jsonb_agg(pg_temp.ulid_to_text(a.id) ORDER BY a.id), '[]'::jsonb)
+        FROM attachment AS a
+        WHERE a.message_id = m.id
+    )
+)
+WHERE m.deleted_at IS NULL AND m.type IN ('file', 'image');
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS poll_vote;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- The votes of users in polls (messages of type poll), a row is stored for each option chosen by the user. option_index is
+-- the position of the option in the payload of the poll
+CREATE TABLE IF NOT EXISTS poll_vote (
+    message_id BYTEA NOT NULL,
+    usr_id BYTEA NOT NULL,
+    option_index SMALLINT NOT NULL CHECK(option_index >= 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_poll_vote PRIMARY KEY (message_id, usr_id, option_index),
+    CONSTRAINT Fk_poll_vote_message FOREIGN KEY (message_id) REFERENCES message(id) ON DELETE CASCADE,
+    CONSTRAINT Fk_poll_vote_usr FOREIGN KEY (usr_id) REFERENCES usr(id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+-- The actors of system messages cannot be restored as senders, since they may have been deleted
+DELETE FROM message WHERE sender_id IS NULL;
+
+ALTER TABLE message
+DROP CONSTRAINT IF EXISTS chk_message_sender_id;
+
+ALTER TABLE message
+ALTER COLUMN sender_id SET NOT NULL;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- System messages do not have a sender, the user who made the change is kept in the actor_id of the payload. Otherwise the
+-- foreign key of sender_id (which has no ON DELETE clause) would prevent the deletion of every user who has ever joined,
+-- left or updated a group
+ALTER TABLE message
+ALTER COLUMN sender_id DROP NOT NULL;
+
+-- Encodes an id as a ULID string, see 000031_add_payload_to_message
+CREATE FUNCTION pg_temp.ulid_to_text(id BYTEA) RETURNS TEXT
+LANGUAGE SQL IMMUTABLE AS $$
+    SELECT string_agg(substr('0123456789ABCDEFGHJKMNPQRSTVWXYZ', 1 + c.v::int, 1), '' ORDER BY i)
+    FROM generate_series(0, 25) AS i
+    CROSS JOIN LATERAL (
+        SELECT sum(get_bit(id, (q / 8) * 8 + 7 - q % 8) << (5 * i + 2 - q)) AS v
+        FROM generate_series(greatest(5 * i - 2, 0), 5 * i + 2) AS q
+    ) AS c
+$$;
+
+UPDATE message
+SET
+    payload = payload || jsonb_build_object('actor_id', pg_temp.ulid_to_text(sender_id)),
+    sender_id = NULL
+WHERE type = 'system';
+
+ALTER TABLE message
+ADD CONSTRAINT chk_message_sender_id
+CHECK (sender_id IS NOT NULL OR type = 'system');
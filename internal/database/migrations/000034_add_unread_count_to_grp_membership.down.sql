@@ -0,0 +1,2 @@
+ALTER TABLE grp_membership
+DROP COLUMN IF EXISTS unread_count;
\ No newline at end of file
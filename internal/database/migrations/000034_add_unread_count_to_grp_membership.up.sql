@@ -0,0 +1,35 @@
+-- The number of unread messages in the timeline of the group, it is updated when messages are sent or deleted, and recounted
+-- from the read marker when the marker moves, so that listing the groups of a user does not count the messages of every group
+ALTER TABLE grp_membership
+ADD COLUMN unread_count INTEGER NOT NULL DEFAULT 0;
+
+-- New members start with a read marker at the last message of the group, members who have not read anything yet get the last
+-- message sent before they joined, so that the unread messages are always the messages after the marker
+UPDATE grp_membership AS mem
+SET last_read_message_id = (
+    SELECT m.id FROM message AS m
+    WHERE
+        m.grp_id = mem.grp_id
+    AND
+        m.thread_root_id IS NULL
+    AND
+        m.created_at <= mem.joined_at
+    ORDER BY m.id DESC
+    LIMIT 1
+)
+WHERE mem.last_read_message_id IS NULL;
+
+UPDATE grp_membership AS mem
+SET unread_count = (
+    SELECT COUNT(*) FROM message AS m
+    WHERE
+        m.grp_id = mem.grp_id
+    AND
+        m.thread_root_id IS NULL
+    AND
+        m.deleted_at IS NULL
+    AND
+        m.sender_id <> mem.usr_id
+    AND
+        (mem.last_read_message_id IS NULL OR m.id > mem.last_read_message_id)
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_attachment_unsent_created_at;
+
+DROP TRIGGER IF EXISTS trg_attachment_queue_blob_deletion ON attachment;
+
+DROP FUNCTION IF EXISTS queue_blob_deletion_on_attachment_delete();
+
+DROP TABLE IF EXISTS blob_deletion;
\ No newline at end of file
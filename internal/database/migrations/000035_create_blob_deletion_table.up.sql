@@ -0,0 +1,26 @@
+-- The blobs of deleted attachments which have not been removed from the blob store yet. Attachments are deleted along with their
+-- message, group or uploader by the cascades, so the trigger queues their storage keys, and the sweeper of the attachment service
+-- deletes the blobs
+CREATE TABLE IF NOT EXISTS blob_deletion (
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT Pk_blob_deletion PRIMARY KEY (storage_key)
+);
+
+CREATE OR REPLACE FUNCTION queue_blob_deletion_on_attachment_delete() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletion (storage_key)
+    VALUES (OLD.storage_key)
+    ON CONFLICT DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_attachment_queue_blob_deletion
+AFTER DELETE ON attachment
+FOR EACH ROW
+EXECUTE FUNCTION queue_blob_deletion_on_attachment_delete();
+
+-- Used to find the attachments which have been uploaded but never sent
+CREATE INDEX IF NOT EXISTS idx_attachment_unsent_created_at ON attachment(created_at) WHERE message_id IS NULL;
@@ -0,0 +1,42 @@
+-- A direct conversation always has exactly two members with the member role, so the ownership of a direct
+-- conversation is never passed on. Direct conversations of a deleted user are deleted instead, since the other member
+-- cannot continue the conversation alone
+CREATE OR REPLACE FUNCTION transfer_grp_ownership_on_usr_delete() RETURNS TRIGGER AS $$
+BEGIN
+    WITH successor AS (
+        SELECT DISTINCT ON (m.grp_id) m.grp_id, m.usr_id
+        FROM grp_membership AS m
+        INNER JOIN grp AS g
+        ON m.grp_id = g.id
+        WHERE
+            g.owner_id = OLD.id
+                AND
+            g.kind <> 'direct'
+                AND
+            m.usr_id <> OLD.id
+        ORDER BY m.grp_id, (m.role = 'admin') DESC, m.joined_at, m.usr_id
+    ), transferred AS (
+        UPDATE grp AS g
+        SET owner_id = s.usr_id
+        FROM successor AS s
+        WHERE g.id = s.grp_id
+        RETURNING g.id, g.owner_id
+    )
+    UPDATE grp_membership AS m
+    SET role = 'owner'
+    FROM transferred AS t
+    WHERE
+        m.grp_id = t.id
+            AND
+        m.usr_id = t.owner_id;
+
+    DELETE FROM grp AS g
+    WHERE
+        g.kind = 'direct'
+            AND
+        EXISTS (SELECT 1 FROM grp_membership AS m WHERE m.grp_id = g.id AND m.usr_id = OLD.id);
+
+    DELETE FROM grp WHERE owner_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,66 @@
+-- name: CreateAttachment :one
+INSERT INTO attachment (id, grp_id, uploader_id, filename, content_type, size, storage_key)
+VALUES (
+    sqlc.arg('id'),
+    sqlc.arg('grp_id'),
+    sqlc.arg('uploader_id'),
+    sqlc.arg('filename'),
+    sqlc.arg('content_type'),
+    sqlc.arg('size'),
+    sqlc.arg('storage_key')
+)
+RETURNING *;
+
+-- name: GetAttachment :one
+SELECT * FROM attachment
+WHERE
+    id = sqlc.arg('id')
+        AND
+    grp_id = sqlc.arg('grp_id');
+
+-- Attaches the given attachments to a message, only the attachments of the group which have been uploaded by the sender, and
+-- have not been attached to another message are updated
+
+-- name: AttachToMessage :many
+UPDATE attachment
+SET message_id = sqlc.arg('message_id')
+WHERE
+    id = ANY(sqlc.arg('ids')::bytea[])
+        AND
+    grp_id = sqlc.arg('grp_id')
+        AND
+    uploader_id = sqlc.arg('uploader_id')
+        AND
+    message_id IS NULL
+RETURNING *;
+
+-- name: GetAttachmentsOfMessages :many
+SELECT * FROM attachment
+WHERE message_id = ANY(sqlc.arg('message_ids')::bytea[])
+ORDER BY message_id, id;
+
+-- Deletes the attachments of a message, the blobs are queued for deletion by the trigger on attachment
+
+-- name: DeleteAttachmentsOfMessage :exec
+DELETE FROM attachment
+WHERE message_id = sqlc.arg('message_id');
+
+-- Deletes the attachments which were uploaded before the given time, but have not been sent in a message
+
+-- name: DeleteUnsentAttachments :execrows
+DELETE FROM attachment
+WHERE
+    message_id IS NULL
+        AND
+    created_at < sqlc.arg('uploaded_before');
+
+-- Returns the storage keys of the blobs which should be removed from the blob store, oldest first
+
+-- name: GetBlobDeletions :many
+SELECT storage_key FROM blob_deletion
+ORDER BY created_at
+LIMIT sqlc.arg('limit');
+
+-- name: DeleteBlobDeletion :exec
+DELETE FROM blob_deletion
+WHERE storage_key = sqlc.arg('storage_key');
@@ -0,0 +1,52 @@
+-- Bans a user from a group, if the user is already banned, the reason and the expiry of the ban are updated
+
+-- name: CreateBan :one
+INSERT INTO grp_ban (grp_id, usr_id, reason, banned_by, expires_at)
+VALUES (
+    sqlc.arg('grp_id'),
+    sqlc.arg('usr_id'),
+    sqlc.arg('reason'),
+    sqlc.arg('banned_by'),
+    sqlc.narg('expires_at')
+)
+ON CONFLICT (grp_id, usr_id) DO UPDATE
+SET
+    reason = EXCLUDED.reason,
+    banned_by = EXCLUDED.banned_by,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at
+RETURNING *;
+
+-- name: DeleteBan :execrows
+DELETE FROM grp_ban
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id = sqlc.arg('usr_id');
+
+-- Check if a user is currently banned from a group, expired bans are ignored
+
+-- name: IsUserBanned :one
+SELECT EXISTS(
+    SELECT 1 FROM grp_ban
+    WHERE
+        grp_id = sqlc.arg('grp_id')
+            AND
+        usr_id = sqlc.arg('usr_id')
+            AND
+        (expires_at IS NULL OR expires_at > NOW())
+    )
+;
+
+-- Returns the active bans of a group, along with the name of the banned users
+
+-- name: GetBansInGroup :many
+SELECT b.*, u.username, u.name FROM
+grp_ban AS b
+INNER JOIN usr AS u
+ON b.usr_id = u.id
+WHERE
+    b.grp_id = sqlc.arg('grp_id')
+        AND
+    (b.expires_at IS NULL OR b.expires_at > NOW())
+ORDER BY b.created_at DESC;
@@ -2,42 +2,81 @@
 SELECT * FROM grp
 WHERE id = sqlc.arg('id') LIMIT 1;
 
--- Returns detailed information about all groups the user is part of
--- Also sorts the returned groups by the last message sent timestamp
--- Also returns the last message (if any) of the group
+-- Returns detailed information about the groups the user is part of
+-- Also sorts the returned groups by the last activity, which is the id of the last message, or the id of the group if no message has been sent
+-- Since ids are ULIDs, the last activity is unique and time ordered, so it is used as the pagination cursor
+-- The last activity changes when a message is sent or deleted, so the cursor is best-effort, clients merge the realtime events
+-- Also returns the last message (if any) of the group, it is looked up using the denormalized last_message_id of the group
 -- Also joins with the user table, and returns the sender name, so that it can be directly rendered in the sidebar
+-- For direct conversations, the other participant is also returned, so that their name can be shown in the sidebar
+-- Also returns the number of unread messages in the timeline, which is kept in the membership, and the first unread message, which is only
+-- looked up if there are unread messages. Messages sent by the user are never unread
 -- name: GetGroups :many
 SELECT 
     g.*,
     mem.role,
     mem.joined_at,
+    mem.last_read_message_id,
     m.content AS last_message_content,
-    m.created_at AS last_message_created_at,
-    last_message_id,
     m.sender_id AS last_message_sender_id,
     m.type AS last_message_type,
-    u.name AS last_message_sender_name
+    m.payload AS last_message_payload,
+    u.name AS last_message_sender_name,
+    peer.id AS peer_id,
+    peer.name AS peer_name,
+    peer.username AS peer_username,
+    COALESCE(g.last_message_id, g.id)::bytea AS last_activity_id,
+    mem.unread_count,
+    (
+        SELECT um.id FROM message AS um
+        WHERE
+            mem.unread_count > 0
+        AND
+            um.grp_id = g.id
+        AND
+            (mem.last_read_message_id IS NULL OR um.id > mem.last_read_message_id)
+        AND
+            um.thread_root_id IS NULL
+        AND
+            um.deleted_at IS NULL
+        AND
+            um.sender_id <> mem.usr_id
+        ORDER BY um.id
+        LIMIT 1
+    ) AS first_unread_id
 FROM grp AS g
 INNER JOIN grp_membership AS mem
     ON g.id = mem.grp_id
-LEFT JOIN (
-    SELECT DISTINCT ON (grp_id)
-        grp_id,
-        id AS last_message_id
-    FROM message
-    ORDER BY grp_id, id DESC
-) AS lm 
-    ON lm.grp_id = g.id
 LEFT JOIN message as m
-    ON m.id = lm.last_message_id
+    ON m.id = g.last_message_id
 LEFT JOIN usr AS u
     ON u.id = m.sender_id
-WHERE mem.usr_id  = sqlc.arg('usr_id')
-ORDER BY lm.last_message_id DESC NULLS LAST;
+LEFT JOIN grp_membership AS peer_mem
+    ON g.kind = 'direct' AND peer_mem.grp_id = g.id AND peer_mem.usr_id <> mem.usr_id
+LEFT JOIN usr AS peer
+    ON peer.id = peer_mem.usr_id
+WHERE
+    mem.usr_id  = sqlc.arg('usr_id')
+AND
+    (sqlc.narg('before')::bytea IS NULL OR COALESCE(g.last_message_id, g.id) < sqlc.narg('before')::bytea)
+ORDER BY last_activity_id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: CreateGroup :one
-INSERT INTO grp (id, name, description, owner_id)
-VALUES (sqlc.arg('id'), sqlc.arg('name'), sqlc.arg('description'), sqlc.arg('owner_id'))
+INSERT INTO grp (id, name, description, owner_id, visibility)
+VALUES (sqlc.arg('id'), sqlc.arg('name'), sqlc.arg('description'), sqlc.arg('owner_id'), sqlc.arg('visibility'))
+RETURNING id;
+
+-- name: GetDirectGroupByPair :one
+SELECT * FROM grp
+WHERE dm_pair = sqlc.arg('dm_pair') LIMIT 1;
+
+-- Creates a direct conversation, if a direct conversation between the pair of users already exists, no row is returned
+
+-- name: CreateDirectGroup :one
+INSERT INTO grp (id, name, description, owner_id, kind, dm_pair, visibility)
+VALUES (sqlc.arg('id'), '', '', sqlc.arg('owner_id'), 'direct', sqlc.arg('dm_pair'), 'private')
+ON CONFLICT (dm_pair) DO NOTHING
 RETURNING id;
 
 -- name: DeleteGroup :exec
@@ -48,9 +87,74 @@ WHERE id = sqlc.arg('id');
 UPDATE grp 
 SET
     name = coalesce(sqlc.narg('name'), name),
-    description = coalesce(sqlc.narg('description'), description)
+    description = coalesce(sqlc.narg('description'), description),
+    visibility = coalesce(sqlc.narg('visibility'), visibility)
 WHERE id = sqlc.arg('id')
 RETURNING *;
 
+-- Changes the owner of a group if it is still owned by the previous owner, so that concurrent transfers cannot both succeed.
+-- The roles of the memberships have to be updated in the same transaction
+
+-- name: UpdateGroupOwner :execrows
+UPDATE grp
+SET owner_id = sqlc.arg('owner_id')
+WHERE
+    id = sqlc.arg('id')
+        AND
+    owner_id = sqlc.arg('previous_owner_id');
+
+-- Records a new message as the last message of the group, and increments the message count. The last message is only replaced
+-- if the new message is newer, so that concurrent transactions cannot move it backwards
+
+-- name: UpdateGroupLastMessage :exec
+UPDATE grp
+SET
+    last_message_id = CASE WHEN last_message_id IS NULL OR last_message_id < sqlc.arg('last_message_id') THEN sqlc.arg('last_message_id') ELSE last_message_id END,
+    last_message_at = CASE WHEN last_message_id IS NULL OR last_message_id < sqlc.arg('last_message_id') THEN sqlc.arg('last_message_at') ELSE last_message_at END,
+    message_count = message_count + 1
+WHERE id = sqlc.arg('id');
+
+-- Decrements the message count after a message has been deleted, and recomputes the last message of the group, deleted messages
+-- are neither counted nor shown as the last message. Replies in threads are not part of the timeline, so they are never counted
+
+-- name: RefreshGroupLastMessage :exec
+UPDATE grp
+SET
+    last_message_id = (SELECT id FROM message WHERE grp_id = sqlc.arg('id') AND deleted_at IS NULL AND thread_root_id IS NULL ORDER BY id DESC LIMIT 1),
+    last_message_at = (SELECT created_at FROM message WHERE grp_id = sqlc.arg('id') AND deleted_at IS NULL AND thread_root_id IS NULL ORDER BY id DESC LIMIT 1),
+    message_count = message_count - 1
+WHERE id = sqlc.arg('id');
+
 -- name: CheckGroupExists :one
-SELECT EXISTS(SELECT 1 FROM grp WHERE id = sqlc.arg('id')) as exists;
\ No newline at end of file
+SELECT EXISTS(SELECT 1 FROM grp WHERE id = sqlc.arg('id')) as exists;
+
+-- Returns public groups along with the number of members in each group, newest groups first
+-- query is a pattern that is matched against the name and the description (case insensitive)
+-- name: GetPublicGroups :many
+SELECT
+    g.*,
+    (SELECT COUNT(*) FROM grp_membership AS mem WHERE mem.grp_id = g.id) AS member_count
+FROM grp AS g
+WHERE
+    g.visibility = 'public'
+AND
+    (sqlc.narg('before')::bytea IS NULL OR g.id < sqlc.narg('before')::bytea)
+AND
+    (sqlc.narg('query')::text IS NULL OR g.name ILIKE sqlc.narg('query')::text OR g.description ILIKE sqlc.narg('query')::text)
+ORDER BY g.id DESC
+LIMIT sqlc.arg('limit');
+
+-- Locks the group while a member is added, so that a concurrent ban of the user waits until the membership is committed. KEY SHARE
+-- does not conflict with the updates of the last message of the group
+
+-- name: LockGroupForJoin :exec
+SELECT id FROM grp
+WHERE id = sqlc.arg('id')
+FOR KEY SHARE;
+
+-- Locks the group while a user is banned, so that members cannot be added until the ban is committed
+
+-- name: LockGroupForBan :exec
+SELECT id FROM grp
+WHERE id = sqlc.arg('id')
+FOR UPDATE;
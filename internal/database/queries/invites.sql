@@ -0,0 +1,55 @@
+-- name: CreateInvite :one
+INSERT INTO grp_invite (id, grp_id, code, created_by, expires_at, max_uses)
+VALUES (
+    sqlc.arg('id'),
+    sqlc.arg('grp_id'),
+    sqlc.arg('code'),
+    sqlc.arg('created_by'),
+    sqlc.narg('expires_at'),
+    sqlc.narg('max_uses')
+)
+RETURNING *;
+
+-- name: GetInviteByCode :one
+SELECT * FROM grp_invite
+WHERE code = sqlc.arg('code') LIMIT 1;
+
+-- name: GetInvitesInGroup :many
+SELECT * FROM grp_invite
+WHERE grp_id = sqlc.arg('grp_id')
+ORDER BY id DESC;
+
+-- name: RevokeInvite :one
+UPDATE grp_invite
+SET revoked = TRUE
+WHERE
+    id = sqlc.arg('id')
+        AND
+    grp_id = sqlc.arg('grp_id')
+RETURNING *;
+
+-- Uses the invite once, the checks and the increment happen in a single statement so that two concurrent
+-- redemptions cannot exceed the maximum number of uses. No row is returned if the invite cannot be used
+
+-- name: ConsumeInvite :one
+UPDATE grp_invite
+SET use_count = use_count + 1
+WHERE
+    code = sqlc.arg('code')
+        AND
+    NOT revoked
+        AND
+    (expires_at IS NULL OR expires_at > NOW())
+        AND
+    (max_uses IS NULL OR use_count < max_uses)
+RETURNING *;
+
+-- Gives back a use of the invite, used when joining the group fails after the invite was consumed
+
+-- name: ReleaseInvite :exec
+UPDATE grp_invite
+SET use_count = use_count - 1
+WHERE
+    id = sqlc.arg('id')
+        AND
+    use_count > 0;
@@ -0,0 +1,52 @@
+-- Creates a pending join request. If the user has already requested to join before, and the request has been decided,
+-- it is made pending again. No row is returned if there is already a pending request
+
+-- name: CreateJoinRequest :one
+INSERT INTO grp_join_request (grp_id, usr_id, message)
+VALUES (sqlc.arg('grp_id'), sqlc.arg('usr_id'), sqlc.arg('message'))
+ON CONFLICT (grp_id, usr_id) DO UPDATE
+SET
+    message = EXCLUDED.message,
+    status = 'pending',
+    created_at = NOW(),
+    decided_at = NULL,
+    decided_by = NULL
+WHERE grp_join_request.status <> 'pending'
+RETURNING *;
+
+-- name: GetJoinRequest :one
+SELECT * FROM grp_join_request
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id = sqlc.arg('usr_id')
+LIMIT 1;
+
+-- Returns the pending join requests of a group, oldest requests first, along with the name of the users
+
+-- name: GetPendingJoinRequests :many
+SELECT r.*, u.username, u.name FROM
+grp_join_request AS r
+INNER JOIN usr AS u
+ON r.usr_id = u.id
+WHERE
+    r.grp_id = sqlc.arg('grp_id')
+        AND
+    r.status = 'pending'
+ORDER BY r.created_at;
+
+-- Approves or rejects a pending join request, no row is returned if the request is not pending
+
+-- name: DecideJoinRequest :one
+UPDATE grp_join_request
+SET
+    status = sqlc.arg('status'),
+    decided_at = NOW(),
+    decided_by = sqlc.arg('decided_by')
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id = sqlc.arg('usr_id')
+        AND
+    status = 'pending'
+RETURNING *;
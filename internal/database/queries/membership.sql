@@ -10,13 +10,52 @@ SELECT EXISTS(
     )
 ;
 
--- Add a user to a group  
+-- Add a user to a group, the read marker of the member starts at the last message of the group, since the messages sent before
+-- the member joined are never unread
 
 -- name: CreateMembership :one
-INSERT INTO grp_membership (grp_id, usr_id, role)
-VALUES (sqlc.arg('grp_id'), sqlc.arg('usr_id'), 'member')
+INSERT INTO grp_membership (grp_id, usr_id, role, last_read_message_id)
+VALUES (sqlc.arg('grp_id'), sqlc.arg('usr_id'), sqlc.arg('role'), (SELECT last_message_id FROM grp WHERE id = sqlc.arg('grp_id')))
 RETURNING joined_at;
 
+-- Add a user to a group unless the user is currently banned from it, no row is returned if the user is banned. The group has to be
+-- locked with LockGroupForJoin, so that a ban which is being committed is seen
+
+-- name: CreateMembershipIfNotBanned :one
+INSERT INTO grp_membership (grp_id, usr_id, role, last_read_message_id)
+SELECT sqlc.arg('grp_id')::bytea, sqlc.arg('usr_id')::bytea, sqlc.arg('role')::text, (SELECT last_message_id FROM grp WHERE id = sqlc.arg('grp_id'))
+WHERE NOT EXISTS (
+    SELECT 1 FROM grp_ban
+    WHERE
+        grp_id = sqlc.arg('grp_id')
+            AND
+        usr_id = sqlc.arg('usr_id')
+            AND
+        (expires_at IS NULL OR expires_at > NOW())
+)
+RETURNING joined_at;
+
+-- Get the membership of a user in a group, used to check the role of the user
+
+-- name: GetMembership :one
+SELECT * FROM grp_membership
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id = sqlc.arg('usr_id')
+LIMIT 1;
+
+-- Change the role of a member
+
+-- name: UpdateMembershipRole :one
+UPDATE grp_membership
+SET role = sqlc.arg('role')
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id = sqlc.arg('usr_id')
+RETURNING *;
+
 -- Remove a user from a group
 
 -- name: DeleteMembership :exec
@@ -35,13 +74,35 @@ WHERE
 grp_id = sqlc.arg('grp_id')
 ;
 
+-- Returns the id of the member of the group with the given username, used to resolve mentions
+
+-- name: GetGroupMemberByUsername :one
+SELECT m.usr_id FROM
+grp_membership AS m
+INNER JOIN usr AS u
+ON m.usr_id = u.id
+WHERE
+    m.grp_id = sqlc.arg('grp_id')
+        AND
+    u.username = sqlc.arg('username')
+LIMIT 1;
+
+-- Returns the members of a group along with their names, the members are ordered by their id (newest users first)
+-- query is a pattern that is matched against the name and the username (case insensitive)
+
 -- name: GetGroupMembersWithName :many
 SELECT m.*, u.username, u.name FROM 
 grp_membership AS m 
 INNER JOIN usr AS u
 ON m.usr_id = u.id
-WHERE grp_id = sqlc.arg('grp_id')
-;
+WHERE
+    grp_id = sqlc.arg('grp_id')
+AND
+    (sqlc.narg('before')::bytea IS NULL OR m.usr_id < sqlc.narg('before')::bytea)
+AND
+    (sqlc.narg('query')::text IS NULL OR u.name ILIKE sqlc.narg('query')::text OR u.username ILIKE sqlc.narg('query')::text)
+ORDER BY m.usr_id DESC
+LIMIT sqlc.arg('limit');
 
 
 -- Get all groups the user is a part of
@@ -50,4 +111,58 @@ WHERE grp_id = sqlc.arg('grp_id')
 SELECT * FROM grp_membership
 WHERE
 usr_id = sqlc.arg('usr_id')
-;
\ No newline at end of file
+;
+
+-- Moves the read marker of the member forward to the given message, the marker never moves backward. The unread count is
+-- recounted from the new marker, which only covers the messages that are still unread
+
+-- name: AdvanceLastReadMessage :execrows
+UPDATE grp_membership AS mem
+SET
+    last_read_message_id = sqlc.arg('last_read_message_id'),
+    unread_count = (
+        SELECT COUNT(*) FROM message AS m
+        WHERE
+            m.grp_id = mem.grp_id
+        AND
+            m.id > sqlc.arg('last_read_message_id')
+        AND
+            m.thread_root_id IS NULL
+        AND
+            m.deleted_at IS NULL
+        AND
+            m.sender_id <> mem.usr_id
+    )
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id = sqlc.arg('usr_id')
+        AND
+    (last_read_message_id IS NULL OR last_read_message_id < sqlc.arg('last_read_message_id'))
+;
+
+-- Counts a new message in the timeline of the group as unread for every member except its sender
+
+-- name: IncrementUnreadCounts :exec
+UPDATE grp_membership
+SET unread_count = unread_count + 1
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id <> sqlc.arg('sender_id')
+;
+
+-- Removes a deleted message of the timeline from the unread count of the members who have not read it yet
+
+-- name: DecrementUnreadCounts :exec
+UPDATE grp_membership
+SET unread_count = unread_count - 1
+WHERE
+    grp_id = sqlc.arg('grp_id')
+        AND
+    usr_id <> sqlc.arg('sender_id')
+        AND
+    unread_count > 0
+        AND
+    (last_read_message_id IS NULL OR last_read_message_id < sqlc.arg('message_id'))
+;
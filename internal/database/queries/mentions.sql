@@ -0,0 +1,43 @@
+-- name: AddMention :exec
+INSERT INTO message_mention (message_id, usr_id, start_offset, length)
+VALUES (sqlc.arg('message_id'), sqlc.arg('usr_id'), sqlc.arg('start_offset'), sqlc.arg('length'));
+
+-- Removes the mentions of a message, and returns the users who were mentioned
+
+-- name: DeleteMentionsOfMessage :many
+DELETE FROM message_mention
+WHERE message_id = sqlc.arg('message_id')
+RETURNING usr_id;
+
+-- Returns the mentions in the given messages along with the current usernames of the mentioned users, in the order in which
+-- they appear in the content
+
+-- name: GetMentionsOfMessages :many
+SELECT mm.message_id, mm.usr_id, mm.start_offset, mm.length, u.username FROM
+message_mention AS mm
+INNER JOIN usr AS u
+ON mm.usr_id = u.id
+WHERE mm.message_id = ANY(sqlc.arg('message_ids')::bytea[])
+ORDER BY mm.message_id, mm.start_offset;
+
+-- Returns the messages in which the user has been mentioned by others, newest first. Only the messages of groups which the
+-- user is still a member of are returned
+
+-- name: GetMentionsOfUser :many
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    id IN (
+        SELECT mm.message_id FROM message_mention AS mm
+        WHERE
+            mm.usr_id = sqlc.arg('usr_id')
+        AND
+            (sqlc.narg('before')::bytea IS NULL OR mm.message_id < sqlc.narg('before')::bytea)
+    )
+AND
+    grp_id IN (SELECT mem.grp_id FROM grp_membership AS mem WHERE mem.usr_id = sqlc.arg('usr_id'))
+AND
+    sender_id <> sqlc.arg('usr_id')
+AND
+    deleted_at IS NULL
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,60 @@
+-- Marks all the messages of the group up to (and including) the given message as delivered or read by the user, messages sent
+-- by the user and deleted messages are skipped. A read message is never marked as delivered again. Returns the messages whose
+-- status has changed, along with their senders. Only the messages after the read marker of the user are considered (or the messages
+-- sent after the user joined, if nothing has been read yet), since the earlier messages have already been read
+
+-- name: MarkMessagesUpTo :many
+WITH marked AS (
+    INSERT INTO message_status (message_id, usr_id, status)
+    SELECT m.id, sqlc.arg('usr_id')::bytea, sqlc.arg('status')::text
+    FROM message AS m
+    INNER JOIN grp_membership AS mem
+    ON mem.grp_id = m.grp_id AND mem.usr_id = sqlc.arg('usr_id')::bytea
+    WHERE
+        m.grp_id = sqlc.arg('grp_id')
+    AND
+        m.id <= sqlc.arg('up_to')
+    AND
+        CASE
+            WHEN mem.last_read_message_id IS NULL THEN m.created_at > mem.joined_at
+            ELSE m.id > mem.last_read_message_id
+        END
+    AND
+        m.sender_id <> sqlc.arg('usr_id')::bytea
+    AND
+        m.deleted_at IS NULL
+    AND
+        NOT EXISTS (
+            SELECT 1 FROM message_status AS s
+            WHERE
+                s.message_id = m.id
+            AND
+                s.usr_id = sqlc.arg('usr_id')::bytea
+            AND
+                (s.status = 'read' OR s.status = sqlc.arg('status')::text)
+        )
+    ON CONFLICT (message_id, usr_id) DO UPDATE
+    SET
+        status = EXCLUDED.status,
+        updated_at = NOW()
+    WHERE message_status.status = 'delivered' AND EXCLUDED.status = 'read'
+    RETURNING message_id, status, updated_at
+)
+SELECT marked.message_id, marked.status, marked.updated_at, m.sender_id FROM
+marked
+INNER JOIN message AS m
+ON marked.message_id = m.id;
+
+-- Returns the status of the message for each current member of the group who has received it
+
+-- name: GetMessageStatuses :many
+SELECT s.usr_id, s.status, s.updated_at, u.username, u.name FROM
+message_status AS s
+INNER JOIN message AS m
+ON s.message_id = m.id
+INNER JOIN grp_membership AS mem
+ON mem.grp_id = m.grp_id AND mem.usr_id = s.usr_id
+INNER JOIN usr AS u
+ON s.usr_id = u.id
+WHERE s.message_id = sqlc.arg('message_id') AND m.grp_id = sqlc.arg('grp_id')
+ORDER BY s.updated_at;
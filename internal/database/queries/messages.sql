@@ -1,21 +1,97 @@
 -- name: GetMessage :one
-SELECT * FROM message
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
 WHERE
     id = sqlc.arg('id')
         AND
     grp_id = sqlc.arg('grp_id')
 LIMIT 1;
 
+-- Returns the timeline of a group, replies in threads are not part of the timeline
+
 -- name: GetMessagesInGroup :many
-SELECT * FROM message
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
 WHERE
     grp_id = sqlc.arg('grp_id')
+AND
+    thread_root_id IS NULL
 AND
     (sqlc.narg('before')::bytea IS NULL OR id < sqlc.narg('before')::bytea)
 ORDER BY id DESC
 LIMIT sqlc.arg('limit');
 
--- name: DeleteMessage :exec
+-- Returns the messages of the timeline after the given message, oldest first, so that the messages closest to it are returned
+
+-- name: GetMessagesInGroupAfter :many
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    grp_id = sqlc.arg('grp_id')
+AND
+    thread_root_id IS NULL
+AND
+    id > sqlc.arg('after')
+ORDER BY id ASC
+LIMIT sqlc.arg('limit');
+
+-- Checks if the timeline has messages with id greater than or equal to the given id
+
+-- name: HasMessagesInGroupFrom :one
+SELECT EXISTS(
+    SELECT 1 FROM message
+    WHERE
+        grp_id = sqlc.arg('grp_id')
+    AND
+        thread_root_id IS NULL
+    AND
+        id >= sqlc.arg('from')
+) AS exists;
+
+-- Checks if the timeline has messages with id less than or equal to the given id
+
+-- name: HasMessagesInGroupUpTo :one
+SELECT EXISTS(
+    SELECT 1 FROM message
+    WHERE
+        grp_id = sqlc.arg('grp_id')
+    AND
+        thread_root_id IS NULL
+    AND
+        id <= sqlc.arg('up_to')
+) AS exists;
+
+-- name: GetThreadMessages :many
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    thread_root_id = sqlc.arg('thread_root_id')
+AND
+    grp_id = sqlc.arg('grp_id')
+AND
+    (sqlc.narg('before')::bytea IS NULL OR id < sqlc.narg('before')::bytea)
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
+
+-- Updates the reply count and the time of the last reply of a thread after a reply has been added
+
+-- name: AddThreadReply :one
+UPDATE message
+SET
+    reply_count = reply_count + 1,
+    last_reply_at = GREATEST(last_reply_at, sqlc.arg('last_reply_at')::timestamptz)
+WHERE id = sqlc.arg('id')
+RETURNING reply_count, last_reply_at;
+
+-- Recomputes the reply count and the time of the last reply of a thread after a reply has been deleted, deleted replies are
+-- not counted
+
+-- name: RefreshThread :exec
+UPDATE message
+SET
+    reply_count = (SELECT COUNT(*) FROM message AS r WHERE r.thread_root_id = sqlc.arg('id') AND r.deleted_at IS NULL),
+    last_reply_at = (SELECT MAX(r.created_at) FROM message AS r WHERE r.thread_root_id = sqlc.arg('id') AND r.deleted_at IS NULL)
+WHERE message.id = sqlc.arg('id');
+
+-- Permanently deletes a message, the revisions of the message are deleted along with it
+
+-- name: DeleteMessage :execrows
 DELETE FROM message
 WHERE 
     id = sqlc.arg('id')
@@ -23,7 +99,127 @@ WHERE
     grp_id = sqlc.arg('grp_id')
 ;
 
+-- Marks a message as deleted and clears its content, the message is kept as a tombstone. Messages that have already been
+-- deleted are not modified
+
+-- name: SoftDeleteMessage :one
+UPDATE message
+SET
+    content = '',
+    payload = '{}'::jsonb,
+    deleted_at = NOW(),
+    deleted_by = sqlc.arg('deleted_by')
+WHERE
+    id = sqlc.arg('id')
+        AND
+    grp_id = sqlc.arg('grp_id')
+        AND
+    deleted_at IS NULL
+RETURNING id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload;
+
+-- name: DeleteMessageRevisions :exec
+DELETE FROM message_revision
+WHERE message_id = sqlc.arg('message_id');
+
 -- name: CreateMessage :one
-INSERT INTO message (id, type, grp_id, content, sender_id)
-VALUES (sqlc.arg('id'), sqlc.arg('type'), sqlc.arg('grp_id'), sqlc.arg('content'), sqlc.arg('sender_id'))
-RETURNING *;
\ No newline at end of file
+INSERT INTO message (id, type, grp_id, content, sender_id, reply_to_id, thread_root_id, payload)
+VALUES (
+    sqlc.arg('id'),
+    sqlc.arg('type'),
+    sqlc.arg('grp_id'),
+    sqlc.arg('content'),
+    sqlc.arg('sender_id'),
+    sqlc.narg('reply_to_id'),
+    sqlc.narg('thread_root_id'),
+    sqlc.arg('payload')
+)
+RETURNING id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload;
+
+-- Returns a compact preview of the given messages, which is embedded in the replies to these messages. The sender is NULL
+-- for system messages
+
+-- name: GetMessagePreviews :many
+SELECT
+    m.id,
+    m.grp_id,
+    m.sender_id,
+    u.name AS sender_name,
+    LEFT(m.content, 100)::text AS content,
+    m.type,
+    m.payload,
+    m.deleted_at
+FROM message AS m
+LEFT JOIN usr AS u
+ON m.sender_id = u.id
+WHERE m.id = ANY(sqlc.arg('ids')::bytea[]);
+
+-- Locks the message, so that concurrent edits of the same message are serialized
+
+-- name: GetMessageForUpdate :one
+SELECT id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload FROM message
+WHERE
+    id = sqlc.arg('id')
+        AND
+    grp_id = sqlc.arg('grp_id')
+LIMIT 1
+FOR UPDATE;
+
+-- name: UpdateMessageContent :one
+UPDATE message
+SET
+    content = sqlc.arg('content'),
+    payload = sqlc.arg('payload'),
+    edited_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING id, type, grp_id, created_at, content, sender_id, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id, reply_count, last_reply_at, payload;
+
+-- name: CreateMessageRevision :exec
+INSERT INTO message_revision (id, message_id, content)
+VALUES (sqlc.arg('id'), sqlc.arg('message_id'), sqlc.arg('content'));
+
+-- Returns the previous versions of a message, newest first
+
+-- name: GetMessageRevisions :many
+SELECT * FROM message_revision
+WHERE message_id = sqlc.arg('message_id')
+ORDER BY id DESC;
+
+-- Full text search over the messages of the groups the user is a member of, newest first. The content is HTML escaped before
+-- it is highlighted, so the snippet is safe to render as HTML, and the only tags in it are the <mark> tags around the matching words
+
+-- name: SearchMessages :many
+SELECT
+    m.id,
+    m.type,
+    m.grp_id,
+    m.created_at,
+    m.sender_id,
+    m.thread_root_id,
+    g.name AS grp_name,
+    u.name AS sender_name,
+    ts_headline('english', replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), websearch_to_tsquery('english', sqlc.arg('query')::text), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')::text AS snippet
+FROM message AS m
+INNER JOIN grp_membership AS mem
+    ON mem.grp_id = m.grp_id AND mem.usr_id = sqlc.arg('usr_id')
+INNER JOIN grp AS g
+    ON g.id = m.grp_id
+INNER JOIN usr AS u
+    ON u.id = m.sender_id
+WHERE
+    m.content_tsv @@ websearch_to_tsquery('english', sqlc.arg('query')::text)
+AND
+    m.deleted_at IS NULL
+AND
+    (sqlc.narg('grp_id')::bytea IS NULL OR m.grp_id = sqlc.narg('grp_id')::bytea)
+AND
+    (sqlc.narg('sender_id')::bytea IS NULL OR m.sender_id = sqlc.narg('sender_id')::bytea)
+AND
+    (sqlc.narg('since')::timestamptz IS NULL OR m.created_at >= sqlc.narg('since')::timestamptz)
+AND
+    (sqlc.narg('until')::timestamptz IS NULL OR m.created_at < sqlc.narg('until')::timestamptz)
+AND
+    (sqlc.narg('type')::text IS NULL OR m.type = sqlc.narg('type')::text)
+AND
+    (sqlc.narg('before')::bytea IS NULL OR m.id < sqlc.narg('before')::bytea)
+ORDER BY m.id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,24 @@
+-- name: CreateModerationLogEntry :exec
+INSERT INTO moderation_log (id, grp_id, actor_id, action, message_id, target_usr_id)
+VALUES (
+    sqlc.arg('id'),
+    sqlc.arg('grp_id'),
+    sqlc.arg('actor_id'),
+    sqlc.arg('action'),
+    sqlc.arg('message_id'),
+    sqlc.arg('target_usr_id')
+);
+
+-- Returns the moderation log of a group, newest entries first, along with the name of the user who performed the action
+
+-- name: GetModerationLog :many
+SELECT l.*, u.username AS actor_username, u.name AS actor_name FROM
+moderation_log AS l
+LEFT JOIN usr AS u
+ON l.actor_id = u.id
+WHERE
+    l.grp_id = sqlc.arg('grp_id')
+AND
+    (sqlc.narg('before')::bytea IS NULL OR l.id < sqlc.narg('before')::bytea)
+ORDER BY l.id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,16 @@
+-- Stores a vote for each of the chosen options of the poll
+
+-- name: AddPollVotes :exec
+INSERT INTO poll_vote (message_id, usr_id, option_index)
+SELECT sqlc.arg('message_id')::bytea, sqlc.arg('usr_id')::bytea, unnest(sqlc.arg('option_indexes')::smallint[]);
+
+-- name: DeletePollVotesOfUser :exec
+DELETE FROM poll_vote
+WHERE message_id = sqlc.arg('message_id') AND usr_id = sqlc.arg('usr_id');
+
+-- Returns the votes in the given polls, oldest first
+
+-- name: GetPollVotes :many
+SELECT * FROM poll_vote
+WHERE message_id = ANY(sqlc.arg('message_ids')::bytea[])
+ORDER BY created_at, usr_id, option_index;
@@ -0,0 +1,40 @@
+-- name: AddReaction :execrows
+INSERT INTO message_reaction (message_id, usr_id, emoji)
+VALUES (sqlc.arg('message_id'), sqlc.arg('usr_id'), sqlc.arg('emoji'))
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveReaction :execrows
+DELETE FROM message_reaction
+WHERE
+    message_id = sqlc.arg('message_id')
+        AND
+    usr_id = sqlc.arg('usr_id')
+        AND
+    emoji = sqlc.arg('emoji');
+
+-- name: DeleteReactionsOfMessage :exec
+DELETE FROM message_reaction
+WHERE message_id = sqlc.arg('message_id');
+
+-- Returns the reactions to a message along with the names of the users who reacted, oldest first
+
+-- name: GetReactionsOfMessage :many
+SELECT r.emoji, r.usr_id, r.created_at, u.username, u.name FROM
+message_reaction AS r
+INNER JOIN usr AS u
+ON r.usr_id = u.id
+WHERE r.message_id = sqlc.arg('message_id')
+ORDER BY r.created_at, r.usr_id;
+
+-- Returns the number of reactions with each emoji to the given messages, and whether the given user has reacted with that emoji
+
+-- name: GetReactionCounts :many
+SELECT
+    message_id,
+    emoji,
+    COUNT(*) AS count,
+    BOOL_OR(usr_id = sqlc.arg('usr_id'))::boolean AS reacted
+FROM message_reaction
+WHERE message_id = ANY(sqlc.arg('message_ids')::bytea[])
+GROUP BY message_id, emoji
+ORDER BY message_id, MIN(created_at);
@@ -26,6 +26,7 @@ const (
 	ErrValidationFailed = "validation_failed"
 	ErrInternal         = "internal_error"
 	ErrUnauthorized     = "not_authorized"
+	ErrTooLarge         = "too_large"
 )
 
 func NotFound(reason string) *Error {
@@ -52,6 +53,10 @@ func ValidationFailed(reason string) *Error {
 	return &Error{Kind: ErrValidationFailed, Status: http.StatusUnprocessableEntity, Reason: reason}
 }
 
+func TooLarge(reason string) *Error {
+	return &Error{Kind: ErrTooLarge, Status: http.StatusRequestEntityTooLarge, Reason: reason}
+}
+
 func Internal(reason string) *Error {
 	return &Error{Kind: ErrInternal, Status: http.StatusInternalServerError, Reason: reason}
 }
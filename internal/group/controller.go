@@ -3,33 +3,61 @@ package group
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/ananthvk/gochat/internal/attachment"
 	"github.com/ananthvk/gochat/internal/auth"
 	"github.com/ananthvk/gochat/internal/errs"
 	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/ananthvk/gochat/internal/invite"
+	"github.com/ananthvk/gochat/internal/membership"
 	"github.com/ananthvk/gochat/internal/message"
 	"github.com/ananthvk/gochat/internal/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/oklog/ulid/v2"
 )
 
-func Routes(g *GroupService, m *message.MessageService, middlewares middleware.Middlewares) chi.Router {
+func Routes(g *GroupService, m *message.MessageService, i *invite.InviteService, a *attachment.AttachmentService, middlewares middleware.Middlewares) chi.Router {
 	router := chi.NewRouter()
 	router.Use(middlewares.Authenticate)
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) { handleGetAllGroups(g, w, r) })
 	router.Post("/", func(w http.ResponseWriter, r *http.Request) { handleCreateGroup(g, w, r) })
+	router.Get("/directory", func(w http.ResponseWriter, r *http.Request) { handleGetDirectory(g, w, r) })
 	router.Route("/{group_id}", func(r chi.Router) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) { handleGetGroup(g, w, r) })
 		r.Patch("/", func(w http.ResponseWriter, r *http.Request) { handleUpdateGroup(g, w, r) })
 		r.Delete("/", func(w http.ResponseWriter, r *http.Request) { handleDeleteGroup(g, w, r) })
 		r.Put("/member", func(w http.ResponseWriter, r *http.Request) { handleJoinGroup(g, w, r) })
 		r.Get("/member", func(w http.ResponseWriter, r *http.Request) { handleGetMembers(g, w, r) })
+		r.Delete("/member", func(w http.ResponseWriter, r *http.Request) { handleLeaveGroup(g, w, r) })
+		r.Patch("/member/{user_id}", func(w http.ResponseWriter, r *http.Request) { handleUpdateMemberRole(g, w, r) })
+		r.Delete("/member/{user_id}", func(w http.ResponseWriter, r *http.Request) { handleRemoveMember(g, w, r) })
+		r.Post("/transfer", func(w http.ResponseWriter, r *http.Request) { handleTransferOwnership(g, w, r) })
+		r.Post("/join-request", func(w http.ResponseWriter, r *http.Request) { handleRequestToJoin(g, w, r) })
+		r.Get("/join-request", func(w http.ResponseWriter, r *http.Request) { handleGetJoinRequests(g, w, r) })
+		r.Post("/join-request/{user_id}/approve", func(w http.ResponseWriter, r *http.Request) { handleDecideJoinRequest(g, true, w, r) })
+		r.Post("/join-request/{user_id}/reject", func(w http.ResponseWriter, r *http.Request) { handleDecideJoinRequest(g, false, w, r) })
+		r.Get("/ban", func(w http.ResponseWriter, r *http.Request) { handleGetBans(g, w, r) })
+		r.Put("/ban/{user_id}", func(w http.ResponseWriter, r *http.Request) { handleBanUser(g, w, r) })
+		r.Delete("/ban/{user_id}", func(w http.ResponseWriter, r *http.Request) { handleUnbanUser(g, w, r) })
+		r.Get("/moderation-log", func(w http.ResponseWriter, r *http.Request) { handleGetModerationLog(g, w, r) })
 		r.Mount("/message", message.Routes(m, middlewares))
+		r.Mount("/invite", invite.Routes(i, middlewares))
+		r.Mount("/attachment", attachment.Routes(a, middlewares))
 	})
 	return router
 }
 
+// DirectRoutes returns the routes for direct conversations, it is mounted under /dm
+func DirectRoutes(g *GroupService, middlewares middleware.Middlewares) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middlewares.Authenticate)
+	router.Post("/{user_id}", func(w http.ResponseWriter, r *http.Request) { handleGetOrCreateDirect(g, w, r) })
+	return router
+}
+
 func handleCreateGroup(g *GroupService, w http.ResponseWriter, r *http.Request) {
 	userId, ok := auth.UserIdFromContext(r.Context())
 	if !ok {
@@ -51,7 +79,11 @@ func handleCreateGroup(g *GroupService, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	id, appErr := g.Create(r.Context(), grp.Name, grp.Description, userId)
+	if grp.Visibility == "" {
+		grp.Visibility = membership.VisibilityUnlisted
+	}
+
+	id, appErr := g.Create(r.Context(), grp.Name, grp.Description, grp.Visibility, userId)
 	if appErr != nil {
 		helpers.RespondWithAppError(w, appErr)
 		return
@@ -82,6 +114,8 @@ func handleGetGroup(g *GroupService, w http.ResponseWriter, r *http.Request) {
 		Name:        grp.Name,
 		Description: grp.Description,
 		OwnerId:     ulid.ULID(grp.OwnerID).String(),
+		Kind:        grp.Kind,
+		Visibility:  grp.Visibility,
 	})
 }
 
@@ -140,6 +174,9 @@ func handleUpdateGroup(g *GroupService, w http.ResponseWriter, r *http.Request)
 		CreatedAt:   grp.CreatedAt.Time,
 		Name:        grp.Name,
 		Description: grp.Description,
+		OwnerId:     ulid.ULID(grp.OwnerID).String(),
+		Kind:        grp.Kind,
+		Visibility:  grp.Visibility,
 	})
 }
 
@@ -149,9 +186,14 @@ func handleGetAllGroups(g *GroupService, w http.ResponseWriter, r *http.Request)
 		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot get all groups without login")
 		return
 	}
-	grps, err := g.GetAll(r.Context(), userId)
+	pagination, err := readPagination(r.URL.Query())
 	if err != nil {
-		helpers.RespondWithAppError(w, err)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	grps, hasMoreBefore, appErr := g.GetAll(r.Context(), userId, pagination)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
 		return
 	}
 	groups := make([]GroupListResponse, len(grps))
@@ -160,24 +202,55 @@ func handleGetAllGroups(g *GroupService, w http.ResponseWriter, r *http.Request)
 		if grp.LastMessageID != nil {
 			lastMessage = &GroupListMessageResponse{
 				Id:         ulid.ULID(grp.LastMessageID).String(),
-				CreatedAt:  grp.LastMessageCreatedAt.Time,
+				CreatedAt:  grp.LastMessageAt.Time,
 				Type:       grp.LastMessageType.String,
 				GrpId:      ulid.ULID(grp.ID).String(),
 				Content:    grp.LastMessageContent.String,
-				SenderId:   ulid.ULID(grp.LastMessageSenderID).String(),
+				Preview:    message.RenderPreview(grp.LastMessageType.String, grp.LastMessagePayload, grp.LastMessageContent.String),
+				SenderId:   helpers.OptionalId(grp.LastMessageSenderID),
 				SenderName: grp.LastMessageSenderName.String,
 			}
 		}
+		var peer *GroupListPeerResponse
+		if grp.PeerID != nil {
+			peer = &GroupListPeerResponse{
+				Id:       ulid.ULID(grp.PeerID).String(),
+				Name:     grp.PeerName.String,
+				Username: grp.PeerUsername.String,
+			}
+		}
+		name := grp.Name
+		if grp.Kind == membership.KindDirect && peer != nil {
+			name = peer.Name
+		}
 		groups[i] = GroupListResponse{
-			Id:          ulid.ULID(grp.ID).String(),
-			CreatedAt:   grp.CreatedAt.Time,
-			Name:        grp.Name,
-			Description: grp.Description,
-			OwnerId:     ulid.ULID(grp.OwnerID).String(),
-			LastMessage: lastMessage,
+			Id:                ulid.ULID(grp.ID).String(),
+			CreatedAt:         grp.CreatedAt.Time,
+			Name:              name,
+			Description:       grp.Description,
+			OwnerId:           ulid.ULID(grp.OwnerID).String(),
+			Kind:              grp.Kind,
+			Visibility:        grp.Visibility,
+			Role:              grp.Role,
+			Peer:              peer,
+			MessageCount:      grp.MessageCount,
+			LastMessage:       lastMessage,
+			LastReadMessageId: helpers.OptionalId(grp.LastReadMessageID),
+			UnreadCount:       int64(grp.UnreadCount),
+			FirstUnreadId:     helpers.OptionalId(grp.FirstUnreadID),
 		}
 	}
-	helpers.RespondWithJSON(w, 200, map[string]any{"groups": groups})
+	beforeId := ""
+	if len(grps) > 0 {
+		beforeId = ulid.ULID(grps[len(grps)-1].LastActivityID).String()
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{
+		"groups": groups,
+		"cursor": Cursor{
+			Before:    beforeId,
+			HasBefore: hasMoreBefore,
+		},
+	})
 }
 
 // Adds the currently authenticated user to the group
@@ -193,7 +266,7 @@ func handleJoinGroup(g *GroupService, w http.ResponseWriter, r *http.Request) {
 		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, err.Error())
 		return
 	}
-	appErr := g.AddMemberToGroup(r.Context(), id, userId)
+	appErr := g.AddMemberToGroup(r.Context(), id, userId, membership.JoinDirect)
 	if appErr != nil {
 		helpers.RespondWithAppError(w, appErr)
 		return
@@ -213,7 +286,17 @@ func handleGetMembers(g *GroupService, w http.ResponseWriter, r *http.Request) {
 		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, err.Error())
 		return
 	}
-	members, appErr := g.GetMembers(r.Context(), id, userId)
+	pagination, err := readPagination(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	query := r.URL.Query().Get("q")
+	if len(query) > 100 {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, "q can have atmost 100 characters")
+		return
+	}
+	members, hasMoreBefore, appErr := g.GetMembers(r.Context(), id, userId, pagination, query)
 	if appErr != nil {
 		helpers.RespondWithAppError(w, appErr)
 		return
@@ -228,5 +311,463 @@ func handleGetMembers(g *GroupService, w http.ResponseWriter, r *http.Request) {
 			Username: member.Username,
 		}
 	}
-	helpers.RespondWithJSON(w, 200, map[string]any{"members": mems})
+	beforeId := ""
+	if len(members) > 0 {
+		beforeId = ulid.ULID(members[len(members)-1].UsrID).String()
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{
+		"members": mems,
+		"cursor": Cursor{
+			Before:    beforeId,
+			HasBefore: hasMoreBefore,
+		},
+	})
+}
+
+// Changes the role of a member of the group, only the owner of the group can do this
+func handleUpdateMemberRole(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot change role of member without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	memberId, err := ulid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	req := MemberRoleUpdateRequest{}
+	err = helpers.ReadJSONBody(r, &req)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(req)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	member, appErr := g.UpdateMemberRole(r.Context(), id, memberId, userId, req.Role)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, MemberResponse{
+		UsrId:    ulid.ULID(member.UsrID).String(),
+		JoinedAt: member.JoinedAt.Time,
+		Role:     member.Role,
+	})
+}
+
+// Removes the currently authenticated user from the group
+func handleLeaveGroup(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot leave group without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	appErr := g.Leave(r.Context(), id, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{"status": true})
+}
+
+// Removes another member from the group, only the owner and admins of the group can do this
+func handleRemoveMember(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot remove member without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	memberId, err := ulid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	appErr := g.RemoveMember(r.Context(), id, memberId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{"status": true})
+}
+
+// Transfers the ownership of the group to another member, only the owner of the group can do this
+func handleTransferOwnership(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot transfer ownership without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	req := OwnershipTransferRequest{}
+	err = helpers.ReadJSONBody(r, &req)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(req)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	newOwnerId, err := ulid.Parse(req.UserId)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	appErr := g.TransferOwnership(r.Context(), id, newOwnerId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{"owner_id": newOwnerId.String()})
+}
+
+// Returns the direct conversation between the currently authenticated user and the given user, creating it if it does not exist
+func handleGetOrCreateDirect(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot start direct conversation without login")
+		return
+	}
+	peerId, err := ulid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	id, created, appErr := g.GetOrCreateDirect(r.Context(), userId, peerId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	helpers.RespondWithJSON(w, status, map[string]any{"id": id, "created": created})
+}
+
+// Returns public groups, optionally filtered by the q query parameter, it implements cursor based pagination
+func handleGetDirectory(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	_, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot view directory without login")
+		return
+	}
+	pagination, err := readPagination(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	query := r.URL.Query().Get("q")
+	if len(query) > 100 {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, "q can have atmost 100 characters")
+		return
+	}
+	grps, hasMoreBefore, appErr := g.GetDirectory(r.Context(), pagination, query)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	groups := make([]DirectoryGroupResponse, len(grps))
+	for i, grp := range grps {
+		groups[i] = DirectoryGroupResponse{
+			Id:          ulid.ULID(grp.ID).String(),
+			CreatedAt:   grp.CreatedAt.Time,
+			Name:        grp.Name,
+			Description: grp.Description,
+			MemberCount: grp.MemberCount,
+		}
+	}
+	beforeId := ""
+	if len(grps) > 0 {
+		beforeId = ulid.ULID(grps[len(grps)-1].ID).String()
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{
+		"groups": groups,
+		"cursor": Cursor{
+			Before:    beforeId,
+			HasBefore: hasMoreBefore,
+		},
+	})
+}
+
+// Creates a request from the currently authenticated user to join a private group
+func handleRequestToJoin(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot request to join group without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	req := JoinRequestCreateRequest{}
+	err = helpers.ReadJSONBody(r, &req)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(req)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	joinReq, appErr := g.RequestToJoin(r.Context(), id, userId, req.Message)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusCreated, JoinRequestResponse{
+		GrpId:     ulid.ULID(joinReq.GrpID).String(),
+		UsrId:     ulid.ULID(joinReq.UsrID).String(),
+		Message:   joinReq.Message,
+		Status:    joinReq.Status,
+		CreatedAt: joinReq.CreatedAt.Time,
+	})
+}
+
+func handleGetJoinRequests(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot list join requests without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	reqs, appErr := g.GetPendingJoinRequests(r.Context(), id, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]JoinRequestResponseWithName, len(reqs))
+	for i, req := range reqs {
+		resp[i] = JoinRequestResponseWithName{
+			UsrId:     ulid.ULID(req.UsrID).String(),
+			Message:   req.Message,
+			CreatedAt: req.CreatedAt.Time,
+			Name:      req.Name,
+			Username:  req.Username,
+		}
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{"join_requests": resp})
+}
+
+// Approves or rejects the join request of a user, only the owner and admins of the group can do this
+func handleDecideJoinRequest(g *GroupService, approve bool, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot decide join request without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	requesterId, err := ulid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	joinReq, appErr := g.DecideJoinRequest(r.Context(), id, requesterId, userId, approve)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, JoinRequestResponse{
+		GrpId:     ulid.ULID(joinReq.GrpID).String(),
+		UsrId:     ulid.ULID(joinReq.UsrID).String(),
+		Message:   joinReq.Message,
+		Status:    joinReq.Status,
+		CreatedAt: joinReq.CreatedAt.Time,
+	})
+}
+
+func banResponse(usrId, bannedBy []byte, reason string, createdAt, expiresAt pgtype.Timestamptz) BanResponse {
+	resp := BanResponse{
+		UsrId:     ulid.ULID(usrId).String(),
+		Reason:    reason,
+		CreatedAt: createdAt.Time,
+	}
+	resp.BannedBy = helpers.OptionalId(bannedBy)
+	if expiresAt.Valid {
+		resp.ExpiresAt = &expiresAt.Time
+	}
+	return resp
+}
+
+// Bans a user from the group, only the owner of the group can do this. If the user is a member, the user is removed from the group
+func handleBanUser(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot ban user without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	targetId, err := ulid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	req := BanCreateRequest{}
+	err = helpers.ReadJSONBody(r, &req)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(req)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	var expiresIn *time.Duration
+	if req.ExpiresIn != nil {
+		d := time.Duration(*req.ExpiresIn) * time.Second
+		expiresIn = &d
+	}
+	ban, appErr := g.Ban(r.Context(), id, targetId, userId, req.Reason, expiresIn)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, banResponse(ban.UsrID, ban.BannedBy, ban.Reason, ban.CreatedAt, ban.ExpiresAt))
+}
+
+func handleUnbanUser(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot unban user without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	targetId, err := ulid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid user_id")
+		return
+	}
+	appErr := g.Unban(r.Context(), id, targetId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{"unbanned": true})
+}
+
+func handleGetBans(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot list bans without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	bans, appErr := g.GetBans(r.Context(), id, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]BanResponseWithName, len(bans))
+	for i, ban := range bans {
+		resp[i] = BanResponseWithName{
+			BanResponse: banResponse(ban.UsrID, ban.BannedBy, ban.Reason, ban.CreatedAt, ban.ExpiresAt),
+			Name:        ban.Name,
+			Username:    ban.Username,
+		}
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{"bans": resp})
+}
+
+// Returns the moderation log of the group, only the owner of the group can do this
+func handleGetModerationLog(g *GroupService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot view moderation log without login")
+		return
+	}
+	id, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	pagination, err := readPagination(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	entries, hasMoreBefore, appErr := g.GetModerationLog(r.Context(), id, userId, pagination)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]ModerationLogEntryResponse, len(entries))
+	for i, entry := range entries {
+		resp[i] = ModerationLogEntryResponse{
+			Id:            ulid.ULID(entry.ID).String(),
+			Action:        entry.Action,
+			ActorId:       helpers.OptionalId(entry.ActorID),
+			ActorName:     entry.ActorName.String,
+			ActorUsername: entry.ActorUsername.String,
+			MessageId:     helpers.OptionalId(entry.MessageID),
+			TargetUsrId:   helpers.OptionalId(entry.TargetUsrID),
+			CreatedAt:     entry.CreatedAt.Time,
+		}
+	}
+	beforeId := ""
+	if len(entries) > 0 {
+		beforeId = ulid.ULID(entries[len(entries)-1].ID).String()
+	}
+	helpers.RespondWithJSON(w, 200, map[string]any{
+		"entries": resp,
+		"cursor": Cursor{
+			Before:    beforeId,
+			HasBefore: hasMoreBefore,
+		},
+	})
 }
@@ -0,0 +1,51 @@
+package group
+
+import (
+	"net/url"
+
+	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/go-playground/validator/v10"
+	"github.com/oklog/ulid/v2"
+)
+
+// This file implements cursor based pagination for lists of groups and members, it works the same way as the pagination of messages.
+// The returned cursor is the sort key of the last item the client has received (the id of a group in the directory, the last activity
+// of a group in the list of groups of the user, and the id of the user in the list of members), in the subsequent request, items < cursor
+// are returned
+
+type Pagination struct {
+	Before *ulid.ULID
+	Limit  int
+}
+
+type Cursor struct {
+	Before    string `json:"before"`
+	HasBefore bool   `json:"has_before"`
+}
+
+func readPagination(u url.Values) (Pagination, error) {
+	before := u.Get("before")
+	pagination := struct {
+		Before string `validate:"omitempty,ulid"`
+	}{
+		Before: before,
+	}
+	validator := validator.New(validator.WithRequiredStructEnabled())
+	err := validator.Struct(pagination)
+	if err != nil {
+		return Pagination{}, err
+	}
+	limit, err := helpers.ReadPageLimit(u)
+	if err != nil {
+		return Pagination{}, err
+	}
+	var beforeId *ulid.ULID
+	if pagination.Before != "" {
+		id := ulid.MustParse(pagination.Before)
+		beforeId = &id
+	}
+	return Pagination{
+		Before: beforeId,
+		Limit:  limit,
+	}, nil
+}
@@ -1,32 +1,39 @@
 package group
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/ananthvk/gochat/internal/database"
 	"github.com/ananthvk/gochat/internal/database/db"
 	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/helpers"
 	"github.com/ananthvk/gochat/internal/membership"
+	"github.com/ananthvk/gochat/internal/message"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/oklog/ulid/v2"
 )
 
 type GroupService struct {
-	Db *database.DatabaseService
+	Db          *database.DatabaseService
+	roomManager RoomManager
 }
 
-func NewGroupService(databaseService *database.DatabaseService) *GroupService {
+func NewGroupService(databaseService *database.DatabaseService, roomManager RoomManager) *GroupService {
 	return &GroupService{
-		Db: databaseService,
+		Db:          databaseService,
+		roomManager: roomManager,
 	}
 }
 
-// Create creates a new group, and adds the user who created to the group as a member. If either the creation, or the member addition
+// Create creates a new group, and adds the user who created to the group as the owner. If either the creation, or the member addition
 // fails, the transaction is rolled back, and an error is returned
-func (g *GroupService) Create(ctx context.Context, name, description string, userId ulid.ULID) (ulid.ULID, *errs.Error) {
+func (g *GroupService) Create(ctx context.Context, name, description, visibility string, userId ulid.ULID) (ulid.ULID, *errs.Error) {
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
@@ -47,14 +54,15 @@ func (g *GroupService) Create(ctx context.Context, name, description string, use
 		Description: description,
 		ID:          id[:],
 		OwnerID:     userId[:],
+		Visibility:  visibility,
 	})
 	if err != nil {
 		slog.ErrorContext(ctx, "internal error while creating group", "error", err)
 		return ulid.ULID{}, errs.Internal("internal server error while creating group")
 	}
 
-	// Add the user who created the group as a member
-	_, err = qtx.CreateMembership(ctx, db.CreateMembershipParams{GrpID: id[:], UsrID: userId[:]})
+	// Add the user who created the group as the owner
+	_, err = qtx.CreateMembership(ctx, db.CreateMembershipParams{GrpID: id[:], UsrID: userId[:], Role: membership.RoleOwner})
 	if err != nil {
 		slog.ErrorContext(ctx, "internal error while adding member to group", "error", err)
 		return ulid.ULID{}, errs.Internal("internal server error while joining group")
@@ -72,7 +80,7 @@ func (g *GroupService) GetOne(ctx context.Context, groupId, userId ulid.ULID) (*
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
-	appErr := membership.IsUserMemberOfGroup(g.Db, ctx, groupId, userId)
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionViewGroup)
 	if appErr != nil {
 		return nil, appErr
 	}
@@ -88,11 +96,17 @@ func (g *GroupService) GetOne(ctx context.Context, groupId, userId ulid.ULID) (*
 	return grp, nil
 }
 
+// Delete deletes the group, only the owner of the group is allowed to delete it
 func (g *GroupService) Delete(ctx context.Context, groupId, userId ulid.ULID) *errs.Error {
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
-	appErr := membership.IsUserMemberOfGroup(g.Db, ctx, groupId, userId)
+	// Direct conversations are only deleted along with either of their members
+	_, appErr := membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return appErr
+	}
+	_, appErr = membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionDeleteGroup)
 	if appErr != nil {
 		return appErr
 	}
@@ -114,19 +128,33 @@ func deref(s *string) string {
 	return *s
 }
 
-// Updates a group (supports partial updates)
+// Updates a group (supports partial updates), only the owner and admins of the group are allowed to update it
 func (g *GroupService) Update(ctx context.Context, req GroupUpdateRequest, groupId, userId ulid.ULID) (*db.Grp, *errs.Error) {
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
-	appErr := membership.IsUserMemberOfGroup(g.Db, ctx, groupId, userId)
+	previous, appErr := membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
 	if appErr != nil {
 		return nil, appErr
 	}
+	_, appErr = membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionUpdateGroup)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while updating group", "error", err)
+		return nil, errs.Internal("internal server error while updating group")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := g.Db.Queries.WithTx(tx)
 
-	group, err := g.Db.Queries.UpdateGroupById(ctx, db.UpdateGroupByIdParams{
+	group, err := qtx.UpdateGroupById(ctx, db.UpdateGroupByIdParams{
 		Name:        pgtype.Text{String: deref(req.Name), Valid: req.Name != nil},
 		Description: pgtype.Text{String: deref(req.Description), Valid: req.Description != nil},
+		Visibility:  pgtype.Text{String: deref(req.Visibility), Valid: req.Visibility != nil},
 		ID:          groupId[:],
 	})
 	if err != nil {
@@ -136,22 +164,63 @@ func (g *GroupService) Update(ctx context.Context, req GroupUpdateRequest, group
 		}
 		return nil, errs.NotFound("group with given id not found")
 	}
+
+	// The changes to the name and the description are recorded in the timeline
+	var changes []*message.SystemPayload
+	if group.Name != previous.Name {
+		changes = append(changes, &message.SystemPayload{Event: message.SystemGroupRenamed, Name: group.Name, PreviousName: previous.Name})
+	}
+	if group.Description != previous.Description {
+		changes = append(changes, &message.SystemPayload{Event: message.SystemDescriptionChanged})
+	}
+	systemMessages := make([]*db.Message, len(changes))
+	for i, change := range changes {
+		systemMessages[i], err = message.CreateSystemMessage(ctx, qtx, groupId, userId, change)
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while creating system message", "error", err)
+			return nil, errs.Internal("internal server error while updating group")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while updating group", "error", err)
+		return nil, errs.Internal("internal server error while updating group")
+	}
+	for _, systemMessage := range systemMessages {
+		message.BroadcastSystemMessage(g.roomManager, systemMessage)
+	}
 	return group, nil
 }
 
-func (g *GroupService) GetAll(ctx context.Context, userId ulid.ULID) ([]*db.GetGroupsRow, *errs.Error) {
+// GetAll returns the groups the user is part of, ordered by the last activity in the group (most recent first)
+func (g *GroupService) GetAll(ctx context.Context, userId ulid.ULID, pagination Pagination) ([]*db.GetGroupsRow, bool, *errs.Error) {
+	hasMoreBefore := false
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
-	grps, err := g.Db.Queries.GetGroups(ctx, userId[:])
+	var beforeBytes []byte
+	if pagination.Before != nil {
+		beforeBytes = pagination.Before[:]
+	}
+	grps, err := g.Db.Queries.GetGroups(ctx, db.GetGroupsParams{
+		UsrID:  userId[:],
+		Before: beforeBytes,
+		Limit:  int32(pagination.Limit + 1),
+	})
 	if err != nil {
 		slog.ErrorContext(ctx, "error", "err", err)
-		return nil, errs.Internal("internal server error while fetching groups")
+		return nil, hasMoreBefore, errs.Internal("internal server error while fetching groups")
+	}
+	if len(grps) == (pagination.Limit + 1) {
+		hasMoreBefore = true
+		grps = grps[:pagination.Limit]
 	}
-	return grps, nil
+	return grps, hasMoreBefore, nil
 }
 
-func (g *GroupService) AddMemberToGroup(ctx context.Context, groupId, userId ulid.ULID) *errs.Error {
+// AddMemberToGroup adds the user to the group as a member. Private groups can only be joined through an invite, approved join
+// requests are handled by DecideJoinRequest
+func (g *GroupService) AddMemberToGroup(ctx context.Context, groupId, userId ulid.ULID, method membership.JoinMethod) *errs.Error {
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
@@ -166,26 +235,746 @@ func (g *GroupService) AddMemberToGroup(ctx context.Context, groupId, userId uli
 		return appErr
 	}
 
-	_, err := g.Db.Queries.CreateMembership(ctx, db.CreateMembershipParams{GrpID: groupId[:], UsrID: userId[:]})
+	// Users can only be added to direct conversations when it is created
+	grp, appErr := membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return appErr
+	}
+	if grp.Visibility == membership.VisibilityPrivate && method == membership.JoinDirect {
+		return errs.NotAuthorized("the group is private, it can only be joined through an invite")
+	}
+
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while adding member to group", "error", err)
+		return errs.Internal("internal server error while joining group")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := g.Db.Queries.WithTx(tx)
+
+	// The ban is checked while the group is locked, so that a ban which is committed at the same time is not bypassed
+	err = qtx.LockGroupForJoin(ctx, groupId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while adding member to group", "error", err)
+		return errs.Internal("internal server error while joining group")
+	}
+	_, err = qtx.CreateMembershipIfNotBanned(ctx, db.CreateMembershipIfNotBannedParams{GrpID: groupId[:], UsrID: userId[:], Role: membership.RoleMember})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while adding member to group", "error", err)
+			return errs.Internal("internal server error while joining group")
+		}
+		return errs.NotAuthorized("user is banned from the group")
+	}
+	systemMessage, err := message.CreateSystemMessage(ctx, qtx, groupId, userId, &message.SystemPayload{Event: message.SystemMemberJoined})
 	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating system message", "error", err)
+		return errs.Internal("internal server error while joining group")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		slog.ErrorContext(ctx, "internal error while adding member to group", "error", err)
 		return errs.Internal("internal server error while joining group")
 	}
+	g.roomManager.AddUserToRoom(groupId, userId)
+	message.BroadcastSystemMessage(g.roomManager, systemMessage)
 	return nil
 }
 
-func (g *GroupService) GetMembers(ctx context.Context, groupId, userId ulid.ULID) ([]*db.GetGroupMembersWithNameRow, *errs.Error) {
+// GetMembers returns the members of the group, optionally filtered by the name or the username of the members
+func (g *GroupService) GetMembers(ctx context.Context, groupId, userId ulid.ULID, pagination Pagination, query string) ([]*db.GetGroupMembersWithNameRow, bool, *errs.Error) {
+	hasMoreBefore := false
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionViewMembers)
+	if appErr != nil {
+		return nil, hasMoreBefore, appErr
+	}
+
+	var beforeBytes []byte
+	if pagination.Before != nil {
+		beforeBytes = pagination.Before[:]
+	}
+	pattern := pgtype.Text{}
+	if query != "" {
+		pattern = pgtype.Text{String: "%" + helpers.EscapeLikePattern(query) + "%", Valid: true}
+	}
+	members, err := g.Db.Queries.GetGroupMembersWithName(ctx, db.GetGroupMembersWithNameParams{
+		GrpID:  groupId[:],
+		Before: beforeBytes,
+		Query:  pattern,
+		Limit:  int32(pagination.Limit + 1),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching members of the group", "error", err)
+		return nil, hasMoreBefore, errs.Internal("internal server error while fetching members")
+	}
+	if len(members) == (pagination.Limit + 1) {
+		hasMoreBefore = true
+		members = members[:pagination.Limit]
+	}
+	return members, hasMoreBefore, nil
+}
+
+// UpdateMemberRole changes the role of a member of the group. Only the owner can promote members to admins or demote admins to
+// members. The role of the owner cannot be changed, ownership has to be transferred instead
+func (g *GroupService) UpdateMemberRole(ctx context.Context, groupId, memberId, userId ulid.ULID, role string) (*db.GrpMembership, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionManageRoles)
+	if appErr != nil {
+		return nil, appErr
+	}
+	_, appErr = membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if role != membership.RoleAdmin && role != membership.RoleMember {
+		return nil, errs.ValidationFailed("role must be either admin or member")
+	}
+
+	target, appErr := membership.GetMembership(g.Db, ctx, groupId, memberId)
+	if appErr != nil {
+		if appErr.Kind == errs.ErrInternal {
+			return nil, appErr
+		}
+		return nil, errs.NotFound("member with the given id not found in the group")
+	}
+	if target.Role == membership.RoleOwner {
+		return nil, errs.BadRequest("the role of the owner cannot be changed")
+	}
+
+	mem, err := g.Db.Queries.UpdateMembershipRole(ctx, db.UpdateMembershipRoleParams{
+		Role:  role,
+		GrpID: groupId[:],
+		UsrID: memberId[:],
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while updating role of member", "error", err)
+			return nil, errs.Internal("internal server error while updating role")
+		}
+		return nil, errs.NotFound("member with the given id not found in the group")
+	}
+	return mem, nil
+}
+
+// TransferOwnership hands the ownership of the group to another member, only the owner can do this. The new owner gets the owner
+// role, and the previous owner becomes an admin. The members of the group are notified about the transfer
+func (g *GroupService) TransferOwnership(ctx context.Context, groupId, newOwnerId, userId ulid.ULID) *errs.Error {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionTransferOwnership)
+	if appErr != nil {
+		return appErr
+	}
+	_, appErr = membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return appErr
+	}
+	if newOwnerId == userId {
+		return errs.BadRequest("already the owner of the group")
+	}
+
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while transferring ownership", "error", err)
+		return errs.Internal("internal server error while transferring ownership")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := g.Db.Queries.WithTx(tx)
+
+	// The ownership is only changed if the user is still the owner, since the role was checked outside of the transaction
+	rows, err := qtx.UpdateGroupOwner(ctx, db.UpdateGroupOwnerParams{OwnerID: newOwnerId[:], ID: groupId[:], PreviousOwnerID: userId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while transferring ownership", "error", err)
+		return errs.Internal("internal server error while transferring ownership")
+	}
+	if rows == 0 {
+		return errs.NotAuthorized("only the owner of the group can transfer the ownership")
+	}
+	_, err = qtx.UpdateMembershipRole(ctx, db.UpdateMembershipRoleParams{Role: membership.RoleOwner, GrpID: groupId[:], UsrID: newOwnerId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while transferring ownership", "error", err)
+			return errs.Internal("internal server error while transferring ownership")
+		}
+		return errs.NotFound("member with the given id not found in the group")
+	}
+	_, err = qtx.UpdateMembershipRole(ctx, db.UpdateMembershipRoleParams{Role: membership.RoleAdmin, GrpID: groupId[:], UsrID: userId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while transferring ownership", "error", err)
+		return errs.Internal("internal server error while transferring ownership")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while transferring ownership", "error", err)
+		return errs.Internal("internal server error while transferring ownership")
+	}
+
+	data, err := json.Marshal(groupEvent{
+		Type:    "ownership_transferred",
+		Payload: ownershipEventPayload{GrpId: groupId.String(), OwnerId: newOwnerId.String(), PreviousOwnerId: userId.String()},
+	})
+	if err != nil {
+		panic("could not marshal json")
+	}
+	g.roomManager.Broadcast(groupId, data)
+	return nil
+}
+
+// Leave removes the user from the group. The owner cannot leave the group, ownership has to be transferred or the group
+// has to be deleted instead
+func (g *GroupService) Leave(ctx context.Context, groupId, userId ulid.ULID) *errs.Error {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	mem, appErr := membership.GetMembership(g.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return appErr
+	}
+	_, appErr = membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return appErr
+	}
+	if mem.Role == membership.RoleOwner {
+		return errs.BadRequest("the owner cannot leave the group, transfer ownership or delete the group instead")
+	}
+	return g.removeMember(ctx, groupId, userId, userId)
+}
+
+// RemoveMember removes another member from the group. The owner can remove admins and members, while admins can only remove
+// members
+func (g *GroupService) RemoveMember(ctx context.Context, groupId, memberId, userId ulid.ULID) *errs.Error {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	mem, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionRemoveMember)
+	if appErr != nil {
+		return appErr
+	}
+	_, appErr = membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return appErr
+	}
+	if memberId == userId {
+		return errs.BadRequest("cannot remove yourself from the group, leave the group instead")
+	}
+
+	target, appErr := membership.GetMembership(g.Db, ctx, groupId, memberId)
+	if appErr != nil {
+		if appErr.Kind == errs.ErrInternal {
+			return appErr
+		}
+		return errs.NotFound("member with the given id not found in the group")
+	}
+	if !membership.Outranks(mem.Role, target.Role) {
+		return errs.NotAuthorized("not authorized to remove a member with the role " + target.Role)
+	}
+	return g.removeMember(ctx, groupId, memberId, userId)
+}
+
+// removeMember deletes the membership, and evicts all connected clients of the member from the room of the group.
+// The remaining members, and the removed member are notified about the removal. actorId is the user who removed the member,
+// it is the member themselves if they left the group
+func (g *GroupService) removeMember(ctx context.Context, groupId, memberId, actorId ulid.ULID) *errs.Error {
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while removing member from group", "error", err)
+		return errs.Internal("internal server error while removing member")
+	}
+	defer tx.Rollback(ctx)
+
+	systemMessage, appErr := deleteMembership(ctx, g.Db.Queries.WithTx(tx), groupId, memberId, actorId)
+	if appErr != nil {
+		return appErr
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while removing member from group", "error", err)
+		return errs.Internal("internal server error while removing member")
+	}
+	g.notifyMemberRemoved(groupId, memberId, systemMessage)
+	return nil
+}
+
+// deleteMembership removes the member from the group in the transaction, and records the removal as a system message
+func deleteMembership(ctx context.Context, qtx *db.Queries, groupId, memberId, actorId ulid.ULID) (*db.Message, *errs.Error) {
+	err := qtx.DeleteMembership(ctx, db.DeleteMembershipParams{GrpID: groupId[:], UsrID: memberId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while removing member from group", "error", err)
+		return nil, errs.Internal("internal server error while removing member")
+	}
+	payload := &message.SystemPayload{Event: message.SystemMemberLeft}
+	if memberId != actorId {
+		payload = &message.SystemPayload{Event: message.SystemMemberRemoved, UserId: memberId.String()}
+	}
+	systemMessage, err := message.CreateSystemMessage(ctx, qtx, groupId, actorId, payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating system message", "error", err)
+		return nil, errs.Internal("internal server error while removing member")
+	}
+	return systemMessage, nil
+}
+
+// notifyMemberRemoved removes the connections of the member from the room after the removal is committed, and notifies both
+// the group and the removed member
+func (g *GroupService) notifyMemberRemoved(groupId, memberId ulid.ULID, systemMessage *db.Message) {
+	g.roomManager.RemoveUserFromRoom(groupId, memberId)
+
+	data, err := json.Marshal(groupEvent{
+		Type:    "member_removed",
+		Payload: memberEventPayload{GrpId: groupId.String(), UsrId: memberId.String()},
+	})
+	if err != nil {
+		panic("could not marshal json")
+	}
+	g.roomManager.Broadcast(groupId, data)
+	g.roomManager.SendToUser(memberId, data)
+	message.BroadcastSystemMessage(g.roomManager, systemMessage)
+}
+
+// directPair returns the key of the direct conversation between two users, it is the concatenation of both the ids in sorted order,
+// so that it is the same irrespective of which user starts the conversation
+func directPair(a, b ulid.ULID) []byte {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return append(a[:], b[:]...)
+}
+
+// GetOrCreateDirect returns the direct conversation between the user and the peer, if it does not exist, it is created and
+// both the users are added to it. The returned bool is true if the conversation was created
+func (g *GroupService) GetOrCreateDirect(ctx context.Context, userId, peerId ulid.ULID) (ulid.ULID, bool, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	if userId == peerId {
+		return ulid.ULID{}, false, errs.BadRequest("cannot start a direct conversation with yourself")
+	}
+	pair := directPair(userId, peerId)
+
+	grp, err := g.Db.Queries.GetDirectGroupByPair(ctx, pair)
+	if err == nil {
+		return ulid.ULID(grp.ID), false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(ctx, "internal error while fetching direct conversation", "error", err)
+		return ulid.ULID{}, false, errs.Internal("internal server error while fetching direct conversation")
+	}
+
+	_, err = g.Db.Queries.GetUserById(ctx, peerId[:])
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching user", "error", err)
+			return ulid.ULID{}, false, errs.Internal("internal server error while creating direct conversation")
+		}
+		return ulid.ULID{}, false, errs.NotFound("user with the given id not found")
+	}
+
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating direct conversation", "error", err)
+		return ulid.ULID{}, false, errs.Internal("internal server error while creating direct conversation")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := g.Db.Queries.WithTx(tx)
+
+	id := ulid.Make()
+	_, err = qtx.CreateDirectGroup(ctx, db.CreateDirectGroupParams{ID: id[:], OwnerID: userId[:], DmPair: pair})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while creating direct conversation", "error", err)
+			return ulid.ULID{}, false, errs.Internal("internal server error while creating direct conversation")
+		}
+		// The conversation was created concurrently by the other user
+		tx.Rollback(ctx)
+		grp, err := g.Db.Queries.GetDirectGroupByPair(ctx, pair)
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while fetching direct conversation", "error", err)
+			return ulid.ULID{}, false, errs.Internal("internal server error while fetching direct conversation")
+		}
+		return ulid.ULID(grp.ID), false, nil
+	}
+
+	// Both the participants are members, so that neither of them can manage the conversation
+	for _, memberId := range []ulid.ULID{userId, peerId} {
+		_, err = qtx.CreateMembership(ctx, db.CreateMembershipParams{GrpID: id[:], UsrID: memberId[:], Role: membership.RoleMember})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while adding member to direct conversation", "error", err)
+			return ulid.ULID{}, false, errs.Internal("internal server error while creating direct conversation")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while creating direct conversation", "error", err)
+		return ulid.ULID{}, false, errs.Internal("internal server error while creating direct conversation")
+	}
+
+	g.roomManager.AddUserToRoom(id, userId)
+	g.roomManager.AddUserToRoom(id, peerId)
+	return id, true, nil
+}
+
+// GetDirectory returns public groups, along with the number of members in each group. If query is not empty, only groups
+// whose name or description contains the query are returned. The returned bool is true if there are more groups
+func (g *GroupService) GetDirectory(ctx context.Context, pagination Pagination, query string) ([]*db.GetPublicGroupsRow, bool, *errs.Error) {
+	hasMoreBefore := false
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	var beforeBytes []byte
+	if pagination.Before != nil {
+		beforeBytes = pagination.Before[:]
+	}
+	pattern := pgtype.Text{}
+	if query != "" {
+		pattern = pgtype.Text{String: "%" + helpers.EscapeLikePattern(query) + "%", Valid: true}
+	}
+
+	grps, err := g.Db.Queries.GetPublicGroups(ctx, db.GetPublicGroupsParams{
+		Before: beforeBytes,
+		Query:  pattern,
+		Limit:  int32(pagination.Limit + 1),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching directory", "error", err)
+		return nil, hasMoreBefore, errs.Internal("internal server error while fetching groups")
+	}
+
+	// If we could retrieve limit + 1 rows, it means that hasBefore should be set to true
+	if len(grps) == (pagination.Limit + 1) {
+		hasMoreBefore = true
+		grps = grps[:pagination.Limit]
+	}
+	return grps, hasMoreBefore, nil
+}
+
+// Status of a join request
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// RequestToJoin creates a join request for a private group, which has to be approved by the owner or an admin of the group.
+// If there is already a pending request, it is returned as is
+func (g *GroupService) RequestToJoin(ctx context.Context, groupId, userId ulid.ULID, message string) (*db.GrpJoinRequest, *errs.Error) {
 	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
 	defer cancel()
 
 	appErr := membership.IsUserMemberOfGroup(g.Db, ctx, groupId, userId)
+	if appErr == nil {
+		return nil, errs.BadRequest("already a member of the group")
+	}
+	if appErr.Kind == errs.ErrInternal {
+		return nil, appErr
+	}
+
+	grp, appErr := membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if grp.Visibility != membership.VisibilityPrivate {
+		return nil, errs.BadRequest("the group is not private, join the group directly instead")
+	}
+	appErr = membership.RequireNotBanned(g.Db, ctx, groupId, userId)
 	if appErr != nil {
 		return nil, appErr
 	}
-	members, err := g.Db.Queries.GetGroupMembersWithName(ctx, groupId[:])
+
+	req, err := g.Db.Queries.CreateJoinRequest(ctx, db.CreateJoinRequestParams{GrpID: groupId[:], UsrID: userId[:], Message: message})
 	if err != nil {
-		slog.ErrorContext(ctx, "internal error while fetching members of the group", "error", err)
-		return nil, errs.Internal("internal server error while fetching members")
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while creating join request", "error", err)
+			return nil, errs.Internal("internal server error while creating join request")
+		}
+		// A pending request already exists
+		req, err = g.Db.Queries.GetJoinRequest(ctx, db.GetJoinRequestParams{GrpID: groupId[:], UsrID: userId[:]})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while fetching join request", "error", err)
+			return nil, errs.Internal("internal server error while creating join request")
+		}
+	}
+	return req, nil
+}
+
+// GetPendingJoinRequests returns the pending join requests of the group, only the owner and admins can view them
+func (g *GroupService) GetPendingJoinRequests(ctx context.Context, groupId, userId ulid.ULID) ([]*db.GetPendingJoinRequestsRow, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionReviewJoinRequests)
+	if appErr != nil {
+		return nil, appErr
+	}
+	reqs, err := g.Db.Queries.GetPendingJoinRequests(ctx, groupId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching join requests", "error", err)
+		return nil, errs.Internal("internal server error while fetching join requests")
+	}
+	return reqs, nil
+}
+
+// DecideJoinRequest approves or rejects a pending join request. If the request is approved, the requester is added to the group as
+// a member in the same transaction, unless the requester has already joined. In both cases, the connected clients of the requester
+// are notified about the decision
+func (g *GroupService) DecideJoinRequest(ctx context.Context, groupId, requesterId, userId ulid.ULID, approve bool) (*db.GrpJoinRequest, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionReviewJoinRequests)
+	if appErr != nil {
+		return nil, appErr
+	}
+	grp, appErr := membership.GetGroup(g.Db, ctx, groupId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	status := JoinRequestRejected
+	if approve {
+		status = JoinRequestApproved
+	}
+
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while deciding join request", "error", err)
+		return nil, errs.Internal("internal server error while deciding join request")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := g.Db.Queries.WithTx(tx)
+
+	req, err := qtx.DecideJoinRequest(ctx, db.DecideJoinRequestParams{
+		Status:    status,
+		DecidedBy: userId[:],
+		GrpID:     groupId[:],
+		UsrID:     requesterId[:],
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while deciding join request", "error", err)
+			return nil, errs.Internal("internal server error while deciding join request")
+		}
+		return nil, errs.NotFound("no pending join request from the given user")
+	}
+
+	var systemMessage *db.Message
+	if approve {
+		// The requester may have been banned after the request was made, the group is locked so that a ban which is committed at
+		// the same time is seen
+		err = qtx.LockGroupForJoin(ctx, groupId[:])
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while deciding join request", "error", err)
+			return nil, errs.Internal("internal server error while deciding join request")
+		}
+		banned, err := qtx.IsUserBanned(ctx, db.IsUserBannedParams{GrpID: groupId[:], UsrID: requesterId[:]})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while checking ban", "error", err)
+			return nil, errs.Internal("internal server error while deciding join request")
+		}
+		if banned {
+			return nil, errs.BadRequest("the requester is banned from the group, the request can only be rejected")
+		}
+		// The requester may have joined through an invite while the request was pending, the request is resolved anyway
+		isMember, err := qtx.CheckMembership(ctx, db.CheckMembershipParams{GrpID: groupId[:], UsrID: requesterId[:]})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while checking membership", "error", err)
+			return nil, errs.Internal("internal server error while deciding join request")
+		}
+		if !isMember {
+			_, err = qtx.CreateMembership(ctx, db.CreateMembershipParams{GrpID: groupId[:], UsrID: requesterId[:], Role: membership.RoleMember})
+			if err != nil {
+				slog.ErrorContext(ctx, "internal error while adding member to group", "error", err)
+				return nil, errs.Internal("internal server error while deciding join request")
+			}
+			systemMessage, err = message.CreateSystemMessage(ctx, qtx, groupId, requesterId, &message.SystemPayload{Event: message.SystemMemberJoined})
+			if err != nil {
+				slog.ErrorContext(ctx, "internal error while creating system message", "error", err)
+				return nil, errs.Internal("internal server error while deciding join request")
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while deciding join request", "error", err)
+		return nil, errs.Internal("internal server error while deciding join request")
+	}
+
+	if systemMessage != nil {
+		g.roomManager.AddUserToRoom(groupId, requesterId)
+		message.BroadcastSystemMessage(g.roomManager, systemMessage)
+	}
+	data, err := json.Marshal(groupEvent{
+		Type: "join_request_" + status,
+		Payload: joinRequestEventPayload{
+			GrpId:     groupId.String(),
+			GrpName:   grp.Name,
+			Status:    status,
+			DecidedBy: userId.String(),
+		},
+	})
+	if err != nil {
+		panic("could not marshal json")
+	}
+	g.roomManager.SendToUser(requesterId, data)
+	return req, nil
+}
+
+// Ban bans a user from the group, only the owner of the group can ban users. If the user is a member of the group, the user is
+// also removed from the group. If expiresIn is nil, the ban is permanent. Banning an already banned user updates the ban
+func (g *GroupService) Ban(ctx context.Context, groupId, targetId, userId ulid.ULID, reason string, expiresIn *time.Duration) (*db.GrpBan, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionManageBans)
+	if appErr != nil {
+		return nil, appErr
+	}
+	_, appErr = membership.RequireGroupKind(g.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if targetId == userId {
+		return nil, errs.BadRequest("cannot ban yourself from the group")
+	}
+
+	_, err := g.Db.Queries.GetUserById(ctx, targetId[:])
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching user", "error", err)
+			return nil, errs.Internal("internal server error while banning user")
+		}
+		return nil, errs.NotFound("user with the given id not found")
+	}
+
+	expiresAt := pgtype.Timestamptz{}
+	if expiresIn != nil {
+		expiresAt = pgtype.Timestamptz{Time: time.Now().Add(*expiresIn), Valid: true}
+	}
+
+	tx, err := g.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while banning user", "error", err)
+		return nil, errs.Internal("internal server error while banning user")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := g.Db.Queries.WithTx(tx)
+
+	// The group is locked, so that joins which are in progress are committed before the membership is checked, and joins which
+	// start later see the ban
+	err = qtx.LockGroupForBan(ctx, groupId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while banning user", "error", err)
+		return nil, errs.Internal("internal server error while banning user")
+	}
+	ban, err := qtx.CreateBan(ctx, db.CreateBanParams{
+		GrpID:     groupId[:],
+		UsrID:     targetId[:],
+		Reason:    reason,
+		BannedBy:  userId[:],
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while banning user", "error", err)
+		return nil, errs.Internal("internal server error while banning user")
+	}
+	isMember, err := qtx.CheckMembership(ctx, db.CheckMembershipParams{GrpID: groupId[:], UsrID: targetId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while checking membership", "error", err)
+		return nil, errs.Internal("internal server error while banning user")
+	}
+	var systemMessage *db.Message
+	if isMember {
+		systemMessage, appErr = deleteMembership(ctx, qtx, groupId, targetId, userId)
+		if appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while banning user", "error", err)
+		return nil, errs.Internal("internal server error while banning user")
+	}
+	if systemMessage != nil {
+		g.notifyMemberRemoved(groupId, targetId, systemMessage)
+	}
+	return ban, nil
+}
+
+// Unban lifts the ban of a user, only the owner of the group can unban users. The user is not added back to the group
+func (g *GroupService) Unban(ctx context.Context, groupId, targetId, userId ulid.ULID) *errs.Error {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionManageBans)
+	if appErr != nil {
+		return appErr
+	}
+	n, err := g.Db.Queries.DeleteBan(ctx, db.DeleteBanParams{GrpID: groupId[:], UsrID: targetId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while unbanning user", "error", err)
+		return errs.Internal("internal server error while unbanning user")
+	}
+	if n == 0 {
+		return errs.NotFound("user is not banned from the group")
+	}
+	return nil
+}
+
+// GetBans returns the active bans of the group, only the owner of the group can view them
+func (g *GroupService) GetBans(ctx context.Context, groupId, userId ulid.ULID) ([]*db.GetBansInGroupRow, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionManageBans)
+	if appErr != nil {
+		return nil, appErr
+	}
+	bans, err := g.Db.Queries.GetBansInGroup(ctx, groupId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching bans", "error", err)
+		return nil, errs.Internal("internal server error while fetching bans")
+	}
+	return bans, nil
+}
+
+// GetModerationLog returns the moderation log of the group, newest entries first. Only the owner of the group can view it
+func (g *GroupService) GetModerationLog(ctx context.Context, groupId, userId ulid.ULID, pagination Pagination) ([]*db.GetModerationLogRow, bool, *errs.Error) {
+	hasMoreBefore := false
+	ctx, cancel := context.WithTimeout(ctx, g.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(g.Db, ctx, groupId, userId, membership.ActionViewModerationLog)
+	if appErr != nil {
+		return nil, hasMoreBefore, appErr
+	}
+
+	var beforeBytes []byte
+	if pagination.Before != nil {
+		beforeBytes = pagination.Before[:]
+	}
+	entries, err := g.Db.Queries.GetModerationLog(ctx, db.GetModerationLogParams{
+		GrpID:  groupId[:],
+		Before: beforeBytes,
+		Limit:  int32(pagination.Limit + 1),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching moderation log", "error", err)
+		return nil, hasMoreBefore, errs.Internal("internal server error while fetching moderation log")
+	}
+	if len(entries) == (pagination.Limit + 1) {
+		hasMoreBefore = true
+		entries = entries[:pagination.Limit]
 	}
-	return members, nil
+	return entries, hasMoreBefore, nil
 }
@@ -2,16 +2,72 @@ package group
 
 import (
 	"time"
+
+	"github.com/oklog/ulid/v2"
 )
 
+// If the visibility is not specified, the group is unlisted
+
 type GroupCreateRequest struct {
 	Name        string `json:"name" validate:"required,min=3"`
 	Description string `json:"description" validate:"required"`
+	Visibility  string `json:"visibility" validate:"omitempty,oneof=public unlisted private"`
 }
 
 type GroupUpdateRequest struct {
 	Name        *string `json:"name" validate:"min=3"`
 	Description *string `json:"description"`
+	Visibility  *string `json:"visibility" validate:"omitempty,oneof=public unlisted private"`
+}
+
+// Only admin and member roles can be assigned, ownership is never assigned through this request
+type MemberRoleUpdateRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type OwnershipTransferRequest struct {
+	UserId string `json:"user_id" validate:"required"`
+}
+
+type JoinRequestCreateRequest struct {
+	Message string `json:"message" validate:"max=500"`
+}
+
+// A ban can last atmost a year, if the duration is not specified, the ban is permanent
+
+type BanCreateRequest struct {
+	Reason    string `json:"reason" validate:"max=500"`
+	ExpiresIn *int   `json:"expires_in" validate:"omitempty,min=60,max=31536000"`
+}
+
+type BanResponse struct {
+	UsrId     string     `json:"usr_id"`
+	Reason    string     `json:"reason"`
+	BannedBy  *string    `json:"banned_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type BanResponseWithName struct {
+	BanResponse
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+type JoinRequestResponse struct {
+	GrpId     string    `json:"group_id"`
+	UsrId     string    `json:"usr_id"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type JoinRequestResponseWithName struct {
+	UsrId     string    `json:"usr_id"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username"`
 }
 
 type GroupResponse struct {
@@ -20,6 +76,8 @@ type GroupResponse struct {
 	CreatedAt   time.Time `json:"created_at"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	Kind        string    `json:"kind"`
+	Visibility  string    `json:"visibility"`
 }
 
 type MemberResponse struct {
@@ -37,12 +95,47 @@ type MemberResponseWithName struct {
 }
 
 type GroupListResponse struct {
-	Id          string                    `json:"id"`
-	OwnerId     string                    `json:"owner_id"`
-	CreatedAt   time.Time                 `json:"created_at"`
-	Name        string                    `json:"name"`
-	Description string                    `json:"description"`
-	LastMessage *GroupListMessageResponse `json:"last_message"`
+	Id           string                    `json:"id"`
+	OwnerId      string                    `json:"owner_id"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	Name         string                    `json:"name"`
+	Description  string                    `json:"description"`
+	Kind         string                    `json:"kind"`
+	Visibility   string                    `json:"visibility"`
+	Role         string                    `json:"role"`
+	Peer         *GroupListPeerResponse    `json:"peer"`
+	MessageCount int64                     `json:"message_count"`
+	LastMessage  *GroupListMessageResponse `json:"last_message"`
+	// The read marker of the user, and the number of messages in the timeline after it
+	LastReadMessageId *string `json:"last_read_message_id"`
+	UnreadCount       int64   `json:"unread_count"`
+	FirstUnreadId     *string `json:"first_unread_id"`
+}
+
+// GroupListPeerResponse is the other participant of a direct conversation
+type GroupListPeerResponse struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+type DirectoryGroupResponse struct {
+	Id          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	MemberCount int64     `json:"member_count"`
+}
+
+type ModerationLogEntryResponse struct {
+	Id            string    `json:"id"`
+	Action        string    `json:"action"`
+	ActorId       *string   `json:"actor_id"`
+	ActorName     string    `json:"actor_name"`
+	ActorUsername string    `json:"actor_username"`
+	MessageId     *string   `json:"message_id"`
+	TargetUsrId   *string   `json:"target_usr_id"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type GroupListMessageResponse struct {
@@ -51,6 +144,39 @@ type GroupListMessageResponse struct {
 	Type       string    `json:"type"`
 	GrpId      string    `json:"group_id"`
 	Content    string    `json:"content"`
-	SenderId   string    `json:"sender_id"`
+	Preview    string    `json:"preview"`
+	SenderId   *string   `json:"sender_id"`
 	SenderName string    `json:"sender_name"`
 }
+
+// RoomManager is an interface that manages the realtime rooms of groups, so that connected clients of a user start or stop
+// receiving events of a group as soon as the user joins or leaves it
+type RoomManager interface {
+	AddUserToRoom(groupId ulid.ULID, userId ulid.ULID)
+	RemoveUserFromRoom(groupId ulid.ULID, userId ulid.ULID)
+	Broadcast(groupId ulid.ULID, message []byte)
+	SendToUser(userId ulid.ULID, message []byte)
+}
+
+type groupEvent struct {
+	Type    string `json:"type"`
+	Payload any    `json:"payload"`
+}
+
+type memberEventPayload struct {
+	GrpId string `json:"group_id"`
+	UsrId string `json:"usr_id"`
+}
+
+type joinRequestEventPayload struct {
+	GrpId     string `json:"group_id"`
+	GrpName   string `json:"group_name"`
+	Status    string `json:"status"`
+	DecidedBy string `json:"decided_by"`
+}
+
+type ownershipEventPayload struct {
+	GrpId           string `json:"group_id"`
+	OwnerId         string `json:"owner_id"`
+	PreviousOwnerId string `json:"previous_owner_id"`
+}
@@ -8,8 +8,10 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/oklog/ulid/v2"
 )
 
 const (
@@ -100,3 +102,17 @@ func ReadJSONBody(r *http.Request, v any) error {
 	reader := http.MaxBytesReader(nil, r.Body, int64(maxRequestJSONBody))
 	return ParseJSON(reader, v, false)
 }
+
+// OptionalId converts a nullable id column to a string, nil is returned if the column is NULL
+func OptionalId(id []byte) *string {
+	if id == nil {
+		return nil
+	}
+	s := ulid.ULID(id).String()
+	return &s
+}
+
+// EscapeLikePattern escapes the special characters of a LIKE pattern, so that the string is matched literally
+func EscapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,29 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 30
+	MaxPageLimit     = 100
+)
+
+// ReadPageLimit reads the limit query parameter of a paginated list, DefaultPageLimit is returned if it is not set. The limit is
+// parsed before its range is checked, since the min and max validators check the length of a string and not its value
+func ReadPageLimit(u url.Values) (int, error) {
+	limit := u.Get("limit")
+	if limit == "" {
+		return DefaultPageLimit, nil
+	}
+	i, err := strconv.Atoi(limit)
+	if err != nil {
+		return 0, fmt.Errorf("limit must be a number")
+	}
+	if i < 1 || i > MaxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+	}
+	return i, nil
+}
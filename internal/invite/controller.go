@@ -0,0 +1,152 @@
+package invite
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ananthvk/gochat/internal/auth"
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/ananthvk/gochat/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/oklog/ulid/v2"
+)
+
+// Routes returns the routes to manage the invites of a group, it is mounted under /group/{group_id}/invite
+func Routes(i *InviteService, middlewares middleware.Middlewares) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middlewares.Authenticate)
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) { handleGetInvites(i, w, r) })
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) { handleCreateInvite(i, w, r) })
+	router.Delete("/{invite_id}", func(w http.ResponseWriter, r *http.Request) { handleRevokeInvite(i, w, r) })
+	return router
+}
+
+// RedeemRoutes returns the routes to use an invite, it is mounted under /invite
+func RedeemRoutes(i *InviteService, middlewares middleware.Middlewares) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middlewares.Authenticate)
+	router.Post("/{code}", func(w http.ResponseWriter, r *http.Request) { handleRedeemInvite(i, w, r) })
+	return router
+}
+
+func inviteResponse(invite *db.GrpInvite) InviteResponse {
+	resp := InviteResponse{
+		Id:        ulid.ULID(invite.ID).String(),
+		GrpId:     ulid.ULID(invite.GrpID).String(),
+		Code:      invite.Code,
+		CreatedBy: ulid.ULID(invite.CreatedBy).String(),
+		CreatedAt: invite.CreatedAt.Time,
+		UseCount:  invite.UseCount,
+		Revoked:   invite.Revoked,
+	}
+	if invite.ExpiresAt.Valid {
+		resp.ExpiresAt = &invite.ExpiresAt.Time
+	}
+	if invite.MaxUses.Valid {
+		resp.MaxUses = &invite.MaxUses.Int32
+	}
+	return resp
+}
+
+func handleCreateInvite(i *InviteService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot create invite without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	req := InviteCreateRequest{}
+	err = helpers.ReadJSONBody(r, &req)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(req)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	var expiresIn *time.Duration
+	if req.ExpiresIn != nil {
+		d := time.Duration(*req.ExpiresIn) * time.Second
+		expiresIn = &d
+	}
+	invite, appErr := i.Create(r.Context(), groupId, userId, expiresIn, req.MaxUses)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusCreated, inviteResponse(invite))
+}
+
+func handleGetInvites(i *InviteService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot list invites without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	invites, appErr := i.GetAll(r.Context(), groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]InviteResponse, len(invites))
+	for idx, invite := range invites {
+		resp[idx] = inviteResponse(invite)
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"invites": resp})
+}
+
+func handleRevokeInvite(i *InviteService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot revoke invite without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	inviteId, err := ulid.Parse(chi.URLParam(r, "invite_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid invite_id")
+		return
+	}
+	invite, appErr := i.Revoke(r.Context(), inviteId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, inviteResponse(invite))
+}
+
+// Adds the currently authenticated user to the group of the invite
+func handleRedeemInvite(i *InviteService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot use invite without login")
+		return
+	}
+	groupId, appErr := i.Redeem(r.Context(), chi.URLParam(r, "code"), userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"group_id": groupId.String()})
+}
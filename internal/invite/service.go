@@ -0,0 +1,170 @@
+package invite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ananthvk/gochat/internal/database"
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/membership"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/oklog/ulid/v2"
+)
+
+const inviteCodeSize = 16 // Size of the invite code in bytes
+
+type InviteService struct {
+	Db          *database.DatabaseService
+	memberAdder MemberAdder
+}
+
+func NewInviteService(databaseService *database.DatabaseService, memberAdder MemberAdder) *InviteService {
+	return &InviteService{
+		Db:          databaseService,
+		memberAdder: memberAdder,
+	}
+}
+
+// Create creates a new invite link for the group, only the owner and admins of the group can create invites.
+// If expiresIn is nil, the invite never expires, and if maxUses is nil, the invite can be used any number of times
+func (i *InviteService) Create(ctx context.Context, groupId, userId ulid.ULID, expiresIn *time.Duration, maxUses *int32) (*db.GrpInvite, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, i.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(i.Db, ctx, groupId, userId, membership.ActionManageInvites)
+	if appErr != nil {
+		return nil, appErr
+	}
+	_, appErr = membership.RequireGroupKind(i.Db, ctx, groupId, membership.KindGroup)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	randomCode := make([]byte, inviteCodeSize)
+	_, err := rand.Read(randomCode)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating invite", "error", err)
+		return nil, errs.Internal("internal server error while creating invite")
+	}
+
+	expiresAt := pgtype.Timestamptz{}
+	if expiresIn != nil {
+		expiresAt = pgtype.Timestamptz{Time: time.Now().Add(*expiresIn), Valid: true}
+	}
+	uses := pgtype.Int4{}
+	if maxUses != nil {
+		uses = pgtype.Int4{Int32: *maxUses, Valid: true}
+	}
+
+	id := ulid.Make()
+	invite, err := i.Db.Queries.CreateInvite(ctx, db.CreateInviteParams{
+		ID:        id[:],
+		GrpID:     groupId[:],
+		Code:      base64.RawURLEncoding.EncodeToString(randomCode),
+		CreatedBy: userId[:],
+		ExpiresAt: expiresAt,
+		MaxUses:   uses,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating invite", "error", err)
+		return nil, errs.Internal("internal server error while creating invite")
+	}
+	return invite, nil
+}
+
+// GetAll returns all invites of the group (including expired and revoked invites), only the owner and admins of the group
+// can view the invites
+func (i *InviteService) GetAll(ctx context.Context, groupId, userId ulid.ULID) ([]*db.GrpInvite, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, i.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(i.Db, ctx, groupId, userId, membership.ActionManageInvites)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	invites, err := i.Db.Queries.GetInvitesInGroup(ctx, groupId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching invites", "error", err)
+		return nil, errs.Internal("internal server error while fetching invites")
+	}
+	return invites, nil
+}
+
+// Revoke revokes the invite, after which it cannot be used to join the group
+func (i *InviteService) Revoke(ctx context.Context, inviteId, groupId, userId ulid.ULID) (*db.GrpInvite, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, i.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(i.Db, ctx, groupId, userId, membership.ActionManageInvites)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	invite, err := i.Db.Queries.RevokeInvite(ctx, db.RevokeInviteParams{ID: inviteId[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while revoking invite", "error", err)
+			return nil, errs.Internal("internal server error while revoking invite")
+		}
+		return nil, errs.NotFound("invite with the given id not found")
+	}
+	return invite, nil
+}
+
+// Redeem adds the user to the group of the invite, and returns the id of the group. If the user is already a member of the group,
+// the invite is not used. Otherwise the expiry and the use count are checked and the invite is used atomically, before the user is
+// added to the group
+func (i *InviteService) Redeem(ctx context.Context, code string, userId ulid.ULID) (ulid.ULID, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, i.Db.QueryTimeout)
+	defer cancel()
+
+	invite, err := i.Db.Queries.GetInviteByCode(ctx, code)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching invite", "error", err)
+			return ulid.ULID{}, errs.Internal("internal server error while fetching invite")
+		}
+		return ulid.ULID{}, errs.NotFound("invite not found")
+	}
+	groupId := ulid.ULID(invite.GrpID)
+
+	appErr := membership.IsUserMemberOfGroup(i.Db, ctx, groupId, userId)
+	if appErr == nil {
+		// Already a member, don't use up the invite
+		return groupId, nil
+	}
+	if appErr.Kind == errs.ErrInternal {
+		return ulid.ULID{}, appErr
+	}
+
+	// Banned users cannot join through an invite, check it before the invite is used up
+	appErr = membership.RequireNotBanned(i.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return ulid.ULID{}, appErr
+	}
+
+	invite, err = i.Db.Queries.ConsumeInvite(ctx, code)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while using invite", "error", err)
+			return ulid.ULID{}, errs.Internal("internal server error while using invite")
+		}
+		return ulid.ULID{}, errs.NotFound("invite has been revoked, has expired, or has reached its maximum number of uses")
+	}
+
+	appErr = i.memberAdder.AddMemberToGroup(ctx, groupId, userId, membership.JoinInvite)
+	if appErr != nil {
+		if err := i.Db.Queries.ReleaseInvite(ctx, invite.ID); err != nil {
+			slog.ErrorContext(ctx, "internal error while releasing invite", "error", err)
+		}
+		return ulid.ULID{}, appErr
+	}
+	return groupId, nil
+}
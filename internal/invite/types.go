@@ -0,0 +1,35 @@
+package invite
+
+import (
+	"context"
+	"time"
+
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/membership"
+	"github.com/oklog/ulid/v2"
+)
+
+// An invite can be valid for atmost 30 days, and can be used atmost 10000 times. If they are not specified,
+// the invite never expires, and can be used any number of times
+
+type InviteCreateRequest struct {
+	ExpiresIn *int   `json:"expires_in" validate:"omitempty,min=60,max=2592000"`
+	MaxUses   *int32 `json:"max_uses" validate:"omitempty,min=1,max=10000"`
+}
+
+type InviteResponse struct {
+	Id        string     `json:"id"`
+	GrpId     string     `json:"group_id"`
+	Code      string     `json:"code"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxUses   *int32     `json:"max_uses"`
+	UseCount  int32      `json:"use_count"`
+	Revoked   bool       `json:"revoked"`
+}
+
+// MemberAdder is an interface that adds a user to a group, it is called after an invite has been successfully consumed
+type MemberAdder interface {
+	AddMemberToGroup(ctx context.Context, groupId, userId ulid.ULID, method membership.JoinMethod) *errs.Error
+}
@@ -0,0 +1,24 @@
+package membership
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ananthvk/gochat/internal/database"
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/oklog/ulid/v2"
+)
+
+// RequireNotBanned returns a not authorized error if the user is currently banned from the group. Expired bans are ignored
+func RequireNotBanned(databaseService *database.DatabaseService, ctx context.Context, groupId ulid.ULID, userId ulid.ULID) *errs.Error {
+	banned, err := databaseService.Queries.IsUserBanned(ctx, db.IsUserBannedParams{GrpID: groupId[:], UsrID: userId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while checking ban", "error", err)
+		return errs.Internal("internal server error while checking ban")
+	}
+	if banned {
+		return errs.NotAuthorized("user is banned from the group")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/ananthvk/gochat/internal/database"
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/oklog/ulid/v2"
+)
+
+// Kinds of conversations. A group can have any number of members, while a direct conversation always has exactly two members
+const (
+	KindGroup  = "group"
+	KindDirect = "direct"
+)
+
+// GetGroup returns the group with the given id, or a not found error if the group does not exist
+func GetGroup(databaseService *database.DatabaseService, ctx context.Context, groupId ulid.ULID) (*db.Grp, *errs.Error) {
+	grp, err := databaseService.Queries.GetGroup(ctx, groupId[:])
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching group", "error", err)
+			return nil, errs.Internal("internal server error while fetching group")
+		}
+		return nil, errs.NotFound("group with the given id not found")
+	}
+	return grp, nil
+}
+
+// RequireGroupKind returns the group if it is of the given kind. Otherwise a bad request error is returned, since the
+// operation is not supported for the other kind of conversation
+func RequireGroupKind(databaseService *database.DatabaseService, ctx context.Context, groupId ulid.ULID, kind string) (*db.Grp, *errs.Error) {
+	grp, appErr := GetGroup(databaseService, ctx, groupId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if grp.Kind != kind {
+		return nil, errs.BadRequest("this operation is not supported for a " + grp.Kind + " conversation")
+	}
+	return grp, nil
+}
@@ -0,0 +1,113 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/ananthvk/gochat/internal/database"
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/oklog/ulid/v2"
+)
+
+// Roles a member can have in a group. There is exactly one owner per group (the user in grp.owner_id)
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Action is an operation on a group that requires a particular role
+type Action int
+
+const (
+	ActionViewGroup Action = iota
+	ActionUpdateGroup
+	ActionDeleteGroup
+	ActionViewMembers
+	ActionManageRoles
+	ActionRemoveMember
+	ActionManageInvites
+	ActionReviewJoinRequests
+	ActionManageBans
+	ActionTransferOwnership
+	ActionPurgeMessages
+	ActionViewModerationLog
+)
+
+// permissions is the permission matrix, it maps a role to the set of actions that the role is allowed to perform
+var permissions = map[string]map[Action]bool{
+	RoleOwner: {
+		ActionViewGroup:          true,
+		ActionUpdateGroup:        true,
+		ActionDeleteGroup:        true,
+		ActionViewMembers:        true,
+		ActionManageRoles:        true,
+		ActionRemoveMember:       true,
+		ActionManageInvites:      true,
+		ActionReviewJoinRequests: true,
+		ActionManageBans:         true,
+		ActionTransferOwnership:  true,
+		ActionPurgeMessages:      true,
+		ActionViewModerationLog:  true,
+	},
+	RoleAdmin: {
+		ActionViewGroup:          true,
+		ActionUpdateGroup:        true,
+		ActionViewMembers:        true,
+		ActionRemoveMember:       true,
+		ActionManageInvites:      true,
+		ActionReviewJoinRequests: true,
+		ActionPurgeMessages:      true,
+	},
+	RoleMember: {
+		ActionViewGroup:   true,
+		ActionViewMembers: true,
+	},
+}
+
+// Can returns true if the role is allowed to perform the action
+func Can(role string, action Action) bool {
+	return permissions[role][action]
+}
+
+// rank orders the roles, a role with a higher rank can act upon members with a lower rank
+var rank = map[string]int{
+	RoleOwner:  3,
+	RoleAdmin:  2,
+	RoleMember: 1,
+}
+
+// Outranks returns true if the role is strictly higher than the other role
+func Outranks(role, other string) bool {
+	return rank[role] > rank[other]
+}
+
+// GetMembership returns the membership of the user in the group. If the user is not a member of the group, a not authorized
+// error is returned
+func GetMembership(databaseService *database.DatabaseService, ctx context.Context, groupId ulid.ULID, userId ulid.ULID) (*db.GrpMembership, *errs.Error) {
+	mem, err := databaseService.Queries.GetMembership(ctx, db.GetMembershipParams{GrpID: groupId[:], UsrID: userId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching membership", "error", err)
+			return nil, errs.Internal("internal server error while fetching group")
+		}
+		return nil, errs.NotAuthorized("not authorized to view details of the group")
+	}
+	return mem, nil
+}
+
+// Authorize checks if the user is a member of the group, and if the role of the user permits the action.
+// On success, the membership of the user is returned
+func Authorize(databaseService *database.DatabaseService, ctx context.Context, groupId ulid.ULID, userId ulid.ULID, action Action) (*db.GrpMembership, *errs.Error) {
+	mem, appErr := GetMembership(databaseService, ctx, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if !Can(mem.Role, action) {
+		return nil, errs.NotAuthorized("the role " + mem.Role + " is not allowed to perform this action")
+	}
+	return mem, nil
+}
@@ -0,0 +1,17 @@
+package membership
+
+// Visibility of a group, it controls whether the group is listed in the directory, and who can join it
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// JoinMethod is the way in which a user joins a group through AddMemberToGroup, private groups can only be joined through an
+// invite. Approved join requests add the member in the same transaction as the decision, so they do not have a join method
+type JoinMethod int
+
+const (
+	JoinDirect JoinMethod = iota
+	JoinInvite
+)
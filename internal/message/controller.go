@@ -3,8 +3,11 @@ package message
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 
+	"github.com/ananthvk/gochat/internal/attachment"
 	"github.com/ananthvk/gochat/internal/auth"
+	"github.com/ananthvk/gochat/internal/database/db"
 	"github.com/ananthvk/gochat/internal/errs"
 	"github.com/ananthvk/gochat/internal/helpers"
 	"github.com/ananthvk/gochat/internal/middleware"
@@ -18,13 +21,90 @@ func Routes(m *MessageService, middlewares middleware.Middlewares) chi.Router {
 	router.Use(middlewares.Authenticate)
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) { handleGetMessages(m, w, r) })
 	router.Post("/", func(w http.ResponseWriter, r *http.Request) { handleCreateMessage(m, w, r) })
+	router.Get("/search", func(w http.ResponseWriter, r *http.Request) { handleSearchGroupMessages(m, w, r) })
 	router.Route("/{message_id}", func(r chi.Router) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) { handleGetMessage(m, w, r) })
+		r.Patch("/", func(w http.ResponseWriter, r *http.Request) { handleEditMessage(m, w, r) })
 		r.Delete("/", func(w http.ResponseWriter, r *http.Request) { handleDeleteMessage(m, w, r) })
+		r.Delete("/purge", func(w http.ResponseWriter, r *http.Request) { handlePurgeMessage(m, w, r) })
+		r.Get("/revision", func(w http.ResponseWriter, r *http.Request) { handleGetMessageRevisions(m, w, r) })
+		r.Post("/read", func(w http.ResponseWriter, r *http.Request) { handleMarkStatus(m, w, r, MessageStatusRead) })
+		r.Post("/delivered", func(w http.ResponseWriter, r *http.Request) { handleMarkStatus(m, w, r, MessageStatusDelivered) })
+		r.Get("/thread", func(w http.ResponseWriter, r *http.Request) { handleGetThread(m, w, r) })
+		r.Get("/reaction", func(w http.ResponseWriter, r *http.Request) { handleGetReactions(m, w, r) })
+		r.Put("/reaction/{emoji}", func(w http.ResponseWriter, r *http.Request) { handleAddReaction(m, w, r) })
+		r.Delete("/reaction/{emoji}", func(w http.ResponseWriter, r *http.Request) { handleRemoveReaction(m, w, r) })
+		r.Post("/vote", func(w http.ResponseWriter, r *http.Request) { handleVote(m, w, r) })
 	})
 	return router
 }
 
+// SearchRoutes are the routes to search the messages of all the groups of the user
+func SearchRoutes(m *MessageService, middlewares middleware.Middlewares) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middlewares.Authenticate)
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) { handleSearchMessages(m, w, r, nil) })
+	return router
+}
+
+// MentionRoutes are the routes of the feed of messages in which the user has been mentioned
+func MentionRoutes(m *MessageService, middlewares middleware.Middlewares) chi.Router {
+	router := chi.NewRouter()
+	router.Use(middlewares.Authenticate)
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) { handleGetMentions(m, w, r) })
+	return router
+}
+
+func messageResponse(message *db.Message) MessageResponse {
+	resp := MessageResponse{
+		Id:          ulid.ULID(message.ID).String(),
+		CreatedAt:   message.CreatedAt.Time,
+		Type:        message.Type,
+		Content:     message.Content,
+		Payload:     message.Payload,
+		GrpId:       ulid.ULID(message.GrpID).String(),
+		SenderId:    helpers.OptionalId(message.SenderID),
+		Reactions:   []ReactionCountResponse{},
+		Entities:    []MessageEntityResponse{},
+		Attachments: []attachment.AttachmentResponse{},
+	}
+	if message.EditedAt.Valid {
+		resp.EditedAt = &message.EditedAt.Time
+	}
+	if message.ReplyToID != nil {
+		replyToId := ulid.ULID(message.ReplyToID).String()
+		resp.ReplyToId = &replyToId
+	}
+	if message.ThreadRootID != nil {
+		threadRootId := ulid.ULID(message.ThreadRootID).String()
+		resp.ThreadRootId = &threadRootId
+	}
+	resp.ReplyCount = message.ReplyCount
+	if message.LastReplyAt.Valid {
+		resp.LastReplyAt = &message.LastReplyAt.Time
+	}
+	// Deleted messages are returned as tombstones, the content has already been cleared when the message was deleted
+	if message.DeletedAt.Valid {
+		resp.Content = ""
+		resp.DeletedAt = &message.DeletedAt.Time
+		if message.DeletedBy != nil {
+			deletedBy := ulid.ULID(message.DeletedBy).String()
+			resp.DeletedBy = &deletedBy
+		}
+	}
+	return resp
+}
+
+func messagePreviewResponse(preview *db.GetMessagePreviewsRow) *MessagePreviewResponse {
+	return &MessagePreviewResponse{
+		Id:         ulid.ULID(preview.ID).String(),
+		SenderId:   helpers.OptionalId(preview.SenderID),
+		SenderName: preview.SenderName.String,
+		Content:    RenderPreview(preview.Type, preview.Payload, preview.Content),
+		Deleted:    preview.DeletedAt.Valid,
+	}
+}
+
 func handleGetMessage(m *MessageService, w http.ResponseWriter, r *http.Request) {
 	userId, ok := auth.UserIdFromContext(r.Context())
 	if !ok {
@@ -46,17 +126,28 @@ func handleGetMessage(m *MessageService, w http.ResponseWriter, r *http.Request)
 		helpers.RespondWithAppError(w, appErr)
 		return
 	}
-
-	msg := MessageResponse{
-		Id:        ulid.ULID(message.ID[:]).String(),
-		CreatedAt: message.CreatedAt.Time,
-		Type:      message.Type,
-		Content:   message.Content,
-		GrpId:     ulid.ULID(message.GrpID).String(),
-		SenderId:  ulid.ULID(message.SenderID).String(),
+	resp, appErr := m.describe(r.Context(), []*db.Message{message}, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	statuses, appErr := m.GetStatuses(r.Context(), messageId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	detail := MessageDetailResponse{MessageResponse: resp[0], Statuses: make([]MessageStatusResponse, len(statuses))}
+	for i, status := range statuses {
+		detail.Statuses[i] = MessageStatusResponse{
+			UserId:    ulid.ULID(status.UsrID).String(),
+			Username:  status.Username,
+			Name:      status.Name,
+			Status:    status.Status,
+			UpdatedAt: status.UpdatedAt.Time,
+		}
 	}
 
-	helpers.RespondWithJSON(w, http.StatusOK, msg)
+	helpers.RespondWithJSON(w, http.StatusOK, detail)
 }
 
 func handleCreateMessage(m *MessageService, w http.ResponseWriter, r *http.Request) {
@@ -85,19 +176,17 @@ func handleCreateMessage(m *MessageService, w http.ResponseWriter, r *http.Reque
 		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
 		return
 	}
-	msg, appErr := m.Create(r.Context(), message.Type, message.Content, groupId, userId)
+	msg, appErr := m.Create(r.Context(), message, groupId, userId)
 	if appErr != nil {
 		helpers.RespondWithAppError(w, appErr)
 		return
 	}
-	helpers.RespondWithJSON(w, http.StatusCreated, MessageResponse{
-		Id:        ulid.ULID(msg.ID).String(),
-		CreatedAt: msg.CreatedAt.Time,
-		Type:      msg.Type,
-		Content:   msg.Content,
-		GrpId:     ulid.ULID(msg.GrpID).String(),
-		SenderId:  ulid.ULID(msg.SenderID).String(),
-	})
+	resp, appErr := m.describe(r.Context(), []*db.Message{msg}, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusCreated, resp[0])
 }
 
 func handleGetMessages(m *MessageService, w http.ResponseWriter, r *http.Request) {
@@ -116,32 +205,170 @@ func handleGetMessages(m *MessageService, w http.ResponseWriter, r *http.Request
 		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
 		return
 	}
-	msgs, hasMoreBefore, appErr := m.GetAll(r.Context(), pagination, groupId, userId)
+	msgs, cursor, appErr := m.GetAll(r.Context(), pagination, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	messages, appErr := m.describe(r.Context(), msgs, userId)
 	if appErr != nil {
 		helpers.RespondWithAppError(w, appErr)
 		return
 	}
-	messages := make([]MessageResponse, len(msgs))
-	for i, message := range msgs {
-		messages[i] = MessageResponse{
-			Id:        ulid.ULID(message.ID[:]).String(),
-			CreatedAt: message.CreatedAt.Time,
-			Type:      message.Type,
-			Content:   message.Content,
-			GrpId:     ulid.ULID(message.GrpID).String(),
-			SenderId:  ulid.ULID(message.SenderID).String(),
+	helpers.RespondWithJSON(w, 200, map[string]any{
+		"messages": messages,
+		"cursor":   cursor,
+	})
+}
+
+func handleSearchGroupMessages(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	handleSearchMessages(m, w, r, &groupId)
+}
+
+// Searches the messages of a group, or of all the groups of the user if groupId is nil
+func handleSearchMessages(m *MessageService, w http.ResponseWriter, r *http.Request, groupId *ulid.ULID) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot search messages without login")
+		return
+	}
+	query, err := readSearchQuery(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	results, hasMoreBefore, appErr := m.Search(r.Context(), query, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]SearchResultResponse, len(results))
+	for i, result := range results {
+		resp[i] = SearchResultResponse{
+			Id:         ulid.ULID(result.ID).String(),
+			GrpId:      ulid.ULID(result.GrpID).String(),
+			GroupName:  result.GrpName,
+			SenderId:   ulid.ULID(result.SenderID).String(),
+			SenderName: result.SenderName,
+			Type:       result.Type,
+			CreatedAt:  result.CreatedAt.Time,
+			Snippet:    result.Snippet,
+		}
+		if result.ThreadRootID != nil {
+			threadRootId := ulid.ULID(result.ThreadRootID).String()
+			resp[i].ThreadRootId = &threadRootId
 		}
 	}
-	beforeId := ""
-	if len(messages) > 0 {
-		beforeId = ulid.ULID(msgs[len(msgs)-1].ID).String()
+	cursor := Cursor{HasBefore: hasMoreBefore}
+	if len(results) > 0 {
+		cursor.Before = resp[len(resp)-1].Id
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{
+		"results": resp,
+		"cursor":  cursor,
+	})
+}
+
+func handleGetMentions(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot view mentions without login")
+		return
+	}
+	pagination, err := readPagination(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	if pagination.After != nil || pagination.Around != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, "mentions can only be paginated backward")
+		return
+	}
+	msgs, hasMoreBefore, appErr := m.GetMentions(r.Context(), pagination, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	messages, appErr := m.describe(r.Context(), msgs, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{
+		"messages": messages,
+		"cursor":   newCursor(msgs, hasMoreBefore, false),
+	})
+}
+
+// Marks all the messages up to (and including) the message as delivered or read by the current user
+func handleMarkStatus(m *MessageService, w http.ResponseWriter, r *http.Request, status string) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot update message status without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	marked, appErr := m.MarkStatus(r.Context(), messageId, groupId, userId, status)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"marked": marked})
+}
+
+// Returns the replies in the thread started by a message, newest first
+func handleGetThread(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot view thread without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	pagination, err := readPagination(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", err))
+		return
+	}
+	if pagination.After != nil || pagination.Around != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, "threads can only be paginated backward")
+		return
+	}
+	msgs, hasMoreBefore, appErr := m.GetThread(r.Context(), pagination, messageId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	messages, appErr := m.describe(r.Context(), msgs, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
 	}
 	helpers.RespondWithJSON(w, 200, map[string]any{
 		"messages": messages,
-		"cursor": Cursor{
-			Before:    beforeId,
-			HasBefore: hasMoreBefore,
-		},
+		"cursor":   newCursor(msgs, hasMoreBefore, false),
 	})
 }
 
@@ -168,3 +395,248 @@ func handleDeleteMessage(m *MessageService, w http.ResponseWriter, r *http.Reque
 	}
 	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"deleted": true})
 }
+
+// Edits the content of a message, only the sender of the message can do this
+func handleEditMessage(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot edit message without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	req := MessageEditRequest{}
+	err = helpers.ReadJSONBody(r, &req)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(req)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	message, appErr := m.Edit(r.Context(), messageId, groupId, userId, req.Content)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp, appErr := m.describe(r.Context(), []*db.Message{message}, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, resp[0])
+}
+
+func handleGetMessageRevisions(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot view message revisions without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	revisions, appErr := m.GetRevisions(r.Context(), messageId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]MessageRevisionResponse, len(revisions))
+	for i, revision := range revisions {
+		resp[i] = MessageRevisionResponse{
+			Id:         ulid.ULID(revision.ID).String(),
+			Content:    revision.Content,
+			ReplacedAt: revision.ReplacedAt.Time,
+		}
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"revisions": resp})
+}
+
+// Permanently deletes a message, only the owner and admins of the group can do this
+func handlePurgeMessage(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot purge message without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	appErr := m.Purge(r.Context(), messageId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"purged": true})
+}
+
+// Replaces the vote of the current user in a poll, and returns the updated results of the poll
+func handleVote(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot vote without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+
+	vote := PollVoteRequest{}
+	err = helpers.ReadJSONBody(r, &vote)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrBadRequest, err.Error())
+		return
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Struct(vote)
+	if err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, fmt.Sprintf("%s", errors))
+		return
+	}
+	poll, appErr := m.Vote(r.Context(), messageId, groupId, userId, vote.Options)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, poll)
+}
+
+// readEmoji reads the emoji of a reaction from the url, it can be percent encoded by the client
+func readEmoji(r *http.Request) (string, error) {
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil {
+		return "", err
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	err = validate.Var(emoji, "required,max=32")
+	if err != nil {
+		return "", err
+	}
+	return emoji, nil
+}
+
+func handleAddReaction(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot react to message without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	emoji, err := readEmoji(r)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, "invalid emoji")
+		return
+	}
+	appErr := m.AddReaction(r.Context(), messageId, groupId, userId, emoji)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"reacted": true})
+}
+
+func handleRemoveReaction(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot remove reaction without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	emoji, err := readEmoji(r)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusUnprocessableEntity, errs.ErrValidationFailed, "invalid emoji")
+		return
+	}
+	appErr := m.RemoveReaction(r.Context(), messageId, groupId, userId, emoji)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+func handleGetReactions(m *MessageService, w http.ResponseWriter, r *http.Request) {
+	userId, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, errs.ErrNotAuthenticated, "cannot view reactions without login")
+		return
+	}
+	groupId, err := ulid.Parse(chi.URLParam(r, "group_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid group_id")
+		return
+	}
+	messageId, err := ulid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, errs.ErrInvalidID, "invalid message_id")
+		return
+	}
+	reactions, appErr := m.GetReactions(r.Context(), messageId, groupId, userId)
+	if appErr != nil {
+		helpers.RespondWithAppError(w, appErr)
+		return
+	}
+	resp := make([]ReactionResponse, len(reactions))
+	for i, reaction := range reactions {
+		resp[i] = ReactionResponse{
+			Emoji:     reaction.Emoji,
+			UserId:    ulid.ULID(reaction.UsrID).String(),
+			Username:  reaction.Username,
+			Name:      reaction.Name,
+			CreatedAt: reaction.CreatedAt.Time,
+		}
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, map[string]any{"reactions": resp})
+}
@@ -0,0 +1,131 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/oklog/ulid/v2"
+)
+
+// This file parses @username mentions in the content of messages
+// A mention is an @ followed by a username, which is not preceded by a letter or a digit (so that emails are not mentions).
+// Only the members of the group can be mentioned, other tokens are left as they are. Trailing dots and hyphens are dropped
+// if the username does not match a member, so that "@alice." at the end of a sentence mentions alice
+
+// At most maxMentions distinct usernames are looked up in a message, the rest are ignored
+const maxMentions = 20
+
+// The type of the entity of a mention in a message
+const MessageEntityMention = "mention"
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]+)`)
+
+type mention struct {
+	UserId   ulid.ULID
+	Username string
+	// The offset and length of the mention (including the @) in unicode code points
+	Start  int32
+	Length int32
+}
+
+// findMentions returns the mentions of members of the group in the content, in the order in which they appear
+func findMentions(ctx context.Context, qtx *db.Queries, groupId ulid.ULID, content string) ([]mention, error) {
+	members := map[string]*ulid.ULID{}
+	lookup := func(username string) (*ulid.ULID, error) {
+		if userId, ok := members[username]; ok {
+			return userId, nil
+		}
+		if len(members) >= maxMentions {
+			return nil, nil
+		}
+		members[username] = nil
+		memberId, err := qtx.GetGroupMemberByUsername(ctx, db.GetGroupMemberByUsernameParams{GrpID: groupId[:], Username: username})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		userId := ulid.ULID(memberId)
+		members[username] = &userId
+		return members[username], nil
+	}
+
+	var mentions []mention
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		username := content[match[2]:match[3]]
+		userId, err := lookup(username)
+		if err != nil {
+			return nil, err
+		}
+		if userId == nil {
+			if trimmed := strings.TrimRight(username, ".-"); trimmed != "" && trimmed != username {
+				username = trimmed
+				userId, err = lookup(username)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if userId == nil {
+			continue
+		}
+		// The @ is a single byte, and it is right before the username
+		at := match[2] - 1
+		mentions = append(mentions, mention{
+			UserId:   *userId,
+			Username: username,
+			Start:    int32(utf8.RuneCountInString(content[:at])),
+			Length:   int32(utf8.RuneCountInString(username) + 1),
+		})
+	}
+	return mentions, nil
+}
+
+// storeMentions stores the mentions of a message
+func storeMentions(ctx context.Context, qtx *db.Queries, messageId []byte, mentions []mention) error {
+	for _, mention := range mentions {
+		err := qtx.AddMention(ctx, db.AddMentionParams{
+			MessageID:   messageId,
+			UsrID:       mention.UserId[:],
+			StartOffset: mention.Start,
+			Length:      mention.Length,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mentionedUsers returns the distinct users mentioned in a message, other than the sender
+func mentionedUsers(mentions []mention, senderId ulid.ULID) []ulid.ULID {
+	var users []ulid.ULID
+	seen := map[ulid.ULID]bool{senderId: true}
+	for _, mention := range mentions {
+		if !seen[mention.UserId] {
+			seen[mention.UserId] = true
+			users = append(users, mention.UserId)
+		}
+	}
+	return users
+}
+
+func mentionEntities(mentions []mention) []MessageEntityResponse {
+	entities := make([]MessageEntityResponse, len(mentions))
+	for i, mention := range mentions {
+		entities[i] = MessageEntityResponse{
+			Type:     MessageEntityMention,
+			Offset:   mention.Start,
+			Length:   mention.Length,
+			UserId:   mention.UserId.String(),
+			Username: mention.Username,
+		}
+	}
+	return entities
+}
@@ -2,56 +2,85 @@ package message
 
 import (
 	"net/url"
-	"strconv"
 
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/helpers"
 	"github.com/go-playground/validator/v10"
 	"github.com/oklog/ulid/v2"
 )
 
-const defaultPageLimit = "30"
-
 // This file implements cursor based pagination for efficient retrieval of messages
-// Note: For now only backward pagination is supported (scroll up), forward pagination needs to be
-// added after search/jump to message functionality is implemented
+// Messages are always returned newest first, and a page can be requested in one of three ways:
+// - before=<id> returns the messages < id (scroll up), this is the default, and without an id the latest messages are returned
+// - after=<id> returns the messages > id (scroll down), used after jumping to an older message
+// - around=<id> returns the message, along with limit messages on each side of it, used to jump to the first unread message or a search hit
 
-// The returned cursor will be the id of the last message the client has received, so in the subsequent request, messages < id will be returned
+// The returned cursor has the ids of the oldest and the newest message of the page, which are used as before / after in the subsequent requests
 
 type Pagination struct {
 	Before *ulid.ULID
+	After  *ulid.ULID
+	Around *ulid.ULID
 	Limit  int
 }
 
 func readPagination(u url.Values) (Pagination, error) {
-	before := u.Get("before")
-	limit := u.Get("limit")
-	if limit == "" {
-		limit = defaultPageLimit
-	}
 	pagination := struct {
-		Before string `validate:"omitempty,ulid"`
-		Limit  string `validate:"number,min=1,max=100"`
+		Before string `validate:"omitempty,ulid,excluded_with=After Around"`
+		After  string `validate:"omitempty,ulid,excluded_with=Before Around"`
+		Around string `validate:"omitempty,ulid,excluded_with=Before After"`
 	}{
-		Before: before,
-		Limit:  limit,
+		Before: u.Get("before"),
+		After:  u.Get("after"),
+		Around: u.Get("around"),
 	}
 	validator := validator.New(validator.WithRequiredStructEnabled())
 	err := validator.Struct(pagination)
 	if err != nil {
 		return Pagination{}, err
 	}
-	i, err := strconv.Atoi(limit)
+	limit, err := helpers.ReadPageLimit(u)
+	if err != nil {
+		return Pagination{}, err
+	}
+	beforeId, err := parseCursorId(pagination.Before)
 	if err != nil {
 		return Pagination{}, err
 	}
-	var beforeId *ulid.ULID
-	if pagination.Before == "" {
-		beforeId = nil
-	} else {
-		id := ulid.MustParse(pagination.Before)
-		beforeId = &id
+	afterId, err := parseCursorId(pagination.After)
+	if err != nil {
+		return Pagination{}, err
+	}
+	aroundId, err := parseCursorId(pagination.Around)
+	if err != nil {
+		return Pagination{}, err
 	}
 	return Pagination{
 		Before: beforeId,
-		Limit:  i,
+		After:  afterId,
+		Around: aroundId,
+		Limit:  limit,
 	}, nil
 }
+
+// parseCursorId parses an optional id, nil is returned if the id is empty
+func parseCursorId(id string) (*ulid.ULID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	parsed, err := ulid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// newCursor creates the cursor of a page of messages, which are ordered newest first
+func newCursor(msgs []*db.Message, hasBefore, hasAfter bool) Cursor {
+	cursor := Cursor{HasBefore: hasBefore, HasAfter: hasAfter}
+	if len(msgs) > 0 {
+		cursor.Before = ulid.ULID(msgs[len(msgs)-1].ID).String()
+		cursor.After = ulid.ULID(msgs[0].ID).String()
+	}
+	return cursor
+}
@@ -0,0 +1,57 @@
+package message
+
+import "strings"
+
+// The payloads of the built in types of messages
+
+func init() {
+	RegisterType(MessageTypeText, func() Payload { return &TextPayload{} }, true)
+	RegisterType(MessageTypeFile, func() Payload { return &FilePayload{} }, true)
+	RegisterType(MessageTypeImage, func() Payload { return &ImagePayload{} }, true)
+	RegisterType(MessageTypePoll, func() Payload { return &PollPayload{} }, true)
+	RegisterType(MessageTypeSystem, func() Payload { return &SystemPayload{} }, false)
+}
+
+// The content of a message can have atmost 4096 characters
+
+type TextPayload struct {
+	Content string `json:"content" validate:"required,max=4096"`
+}
+
+func (p *TextPayload) Text() string        { return p.Content }
+func (p *TextPayload) Preview() string     { return p.Content }
+func (p *TextPayload) SetText(text string) { p.Content = text }
+
+// FilePayload references upto 10 attachments uploaded by the sender, the content is an optional caption
+type FilePayload struct {
+	Content     string   `json:"content" validate:"max=4096"`
+	Attachments []string `json:"attachment_ids" validate:"required,min=1,max=10,unique,dive,ulid"`
+}
+
+func (p *FilePayload) Text() string                              { return p.Content }
+func (p *FilePayload) SetText(text string)                       { p.Content = text }
+func (p *FilePayload) AttachmentIds() []string                   { return p.Attachments }
+func (p *FilePayload) AcceptsAttachment(contentType string) bool { return true }
+
+func (p *FilePayload) Preview() string {
+	if p.Content == "" {
+		return "📎 File"
+	}
+	return "📎 " + p.Content
+}
+
+// ImagePayload is a file payload, which can only reference images
+type ImagePayload struct {
+	FilePayload
+}
+
+func (p *ImagePayload) AcceptsAttachment(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+func (p *ImagePayload) Preview() string {
+	if p.Content == "" {
+		return "📷 Photo"
+	}
+	return "📷 " + p.Content
+}
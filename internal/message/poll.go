@@ -0,0 +1,163 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/oklog/ulid/v2"
+)
+
+// PollPayload is the payload of a poll, members vote for one of the options (or for any number of them if MultipleChoice is
+// set). The voters of anonymous polls are never revealed, and no more votes are accepted after ClosesAt
+type PollPayload struct {
+	Question       string     `json:"question" validate:"required,max=300"`
+	Options        []string   `json:"options" validate:"required,min=2,max=10,unique,dive,required,max=100"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at"`
+}
+
+func (p *PollPayload) Text() string    { return p.Question }
+func (p *PollPayload) Preview() string { return "📊 " + p.Question }
+
+func (p *PollPayload) Validate() error {
+	if p.ClosesAt != nil && !p.ClosesAt.After(time.Now()) {
+		return errors.New("closes_at must be in the future")
+	}
+	return nil
+}
+
+// Closed returns true if the poll no longer accepts votes
+func (p *PollPayload) Closed() bool {
+	return p.ClosesAt != nil && !time.Now().Before(*p.ClosesAt)
+}
+
+// pollResults counts the votes of a poll. If userId is not nil, the options chosen by the user are returned in Vote
+func pollResults(poll *PollPayload, votes []*db.PollVote, userId *ulid.ULID) *PollResponse {
+	options := make([]PollOptionResponse, len(poll.Options))
+	for i, option := range poll.Options {
+		options[i] = PollOptionResponse{Text: option}
+		if !poll.Anonymous {
+			options[i].VoterIds = []string{}
+		}
+	}
+	voters := map[ulid.ULID]bool{}
+	var vote []int
+	if userId != nil {
+		vote = []int{}
+	}
+	for _, v := range votes {
+		index := int(v.OptionIndex)
+		if index >= len(options) {
+			continue
+		}
+		voterId := ulid.ULID(v.UsrID)
+		voters[voterId] = true
+		options[index].Votes++
+		if !poll.Anonymous {
+			options[index].VoterIds = append(options[index].VoterIds, voterId.String())
+		}
+		if userId != nil && voterId == *userId {
+			vote = append(vote, index)
+		}
+	}
+	return &PollResponse{
+		Options:     options,
+		TotalVoters: len(voters),
+		Closed:      poll.Closed(),
+		Vote:        vote,
+	}
+}
+
+// Vote replaces the vote of the user in a poll with the given options, an empty list of options retracts the vote. The updated
+// results are broadcast to the group as a poll_updated event
+func (m *MessageService) Vote(ctx context.Context, messageId, groupId, userId ulid.ULID, options []int) (*PollResponse, *errs.Error) {
+	// Also checks that the user is a member of the group, and that the message has not been deleted
+	message, appErr := m.GetOne(ctx, messageId, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if message.Type != MessageTypePoll {
+		return nil, errs.BadRequest("only polls can be voted on")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while voting", "error", err)
+		return nil, errs.Internal("internal server error while voting")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := m.Db.Queries.WithTx(tx)
+
+	// The poll is locked, so that concurrent votes of the same user do not conflict. The poll is checked after it is
+	// locked, since it could have been closed or deleted in the meantime
+	locked, err := qtx.GetMessageForUpdate(ctx, db.GetMessageForUpdateParams{ID: message.ID, GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, errs.Internal("internal server error while voting")
+		}
+		return nil, errs.NotFound("message with the given id not found")
+	}
+	if locked.DeletedAt.Valid {
+		return nil, errs.NotFound("message with the given id not found")
+	}
+	payload, ok := storedPayload(locked.Type, locked.Payload)
+	if !ok {
+		slog.ErrorContext(ctx, "invalid payload of poll", "message_id", messageId)
+		return nil, errs.Internal("internal server error while voting")
+	}
+	poll := payload.(*PollPayload)
+	if poll.Closed() {
+		return nil, errs.BadRequest("the poll is closed")
+	}
+	if !poll.MultipleChoice && len(options) > 1 {
+		return nil, errs.BadRequest("only one option can be chosen in this poll")
+	}
+	indexes := make([]int16, len(options))
+	for i, option := range options {
+		if option < 0 || option >= len(poll.Options) {
+			return nil, errs.BadRequest(fmt.Sprintf("the poll does not have the option %d", option))
+		}
+		indexes[i] = int16(option)
+	}
+	err = qtx.DeletePollVotesOfUser(ctx, db.DeletePollVotesOfUserParams{MessageID: message.ID, UsrID: userId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while removing votes", "error", err)
+		return nil, errs.Internal("internal server error while voting")
+	}
+	if len(indexes) > 0 {
+		err = qtx.AddPollVotes(ctx, db.AddPollVotesParams{MessageID: message.ID, UsrID: userId[:], OptionIndexes: indexes})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while adding votes", "error", err)
+			return nil, errs.Internal("internal server error while voting")
+		}
+	}
+	votes, err := qtx.GetPollVotes(ctx, [][]byte{message.ID})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching votes", "error", err)
+		return nil, errs.Internal("internal server error while voting")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while voting", "error", err)
+		return nil, errs.Internal("internal server error while voting")
+	}
+	// The votes of the other members are not known to the clients, so the event does not contain a vote
+	m.emit(groupId, "poll_updated", pollEventPayload{
+		MessageId: messageId.String(),
+		GrpId:     groupId.String(),
+		Poll:      pollResults(poll, votes, nil),
+	})
+	return pollResults(poll, votes, &userId), nil
+}
@@ -0,0 +1,118 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ananthvk/gochat/internal/errs"
+	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/go-playground/validator/v10"
+)
+
+// This file implements the registry of message types
+// Each type has a payload, which is a Go struct that is decoded from the payload of the request, and validated with its struct
+// tags (and its Validate method, if it has one). The payload is stored in the payload column, and its text is stored in
+// content, so that messages of every type can be searched, and users can be mentioned in them
+// A new type of message is added by registering its payload, the handlers do not need to know about it
+
+// Payload is the type specific part of a message
+type Payload interface {
+	// Text returns the text of the message, such as the content of a text message, or the caption of an image
+	Text() string
+	// Preview returns a short summary of the message, which is shown in the list of groups and in the replies to the message
+	Preview() string
+}
+
+// payloadValidator is implemented by payloads which need checks that cannot be expressed with struct tags
+type payloadValidator interface {
+	Validate() error
+}
+
+// editablePayload is implemented by payloads whose text can be edited by the sender
+type editablePayload interface {
+	Payload
+	SetText(text string)
+}
+
+// attachmentPayload is implemented by payloads which reference attachments uploaded to the group
+type attachmentPayload interface {
+	Payload
+	AttachmentIds() []string
+	AcceptsAttachment(contentType string) bool
+}
+
+type messageType struct {
+	newPayload func() Payload
+	// Whether members can send messages of the type, some types (such as system messages) are only created by the server
+	creatable bool
+}
+
+var messageTypes = map[string]messageType{}
+
+// RegisterType registers a type of message, newPayload returns a pointer to an empty payload of the type. It should be called
+// from init, and it panics if the type has already been registered
+func RegisterType(name string, newPayload func() Payload, creatable bool) {
+	if _, ok := messageTypes[name]; ok {
+		panic(fmt.Sprintf("message type %q is already registered", name))
+	}
+	messageTypes[name] = messageType{newPayload: newPayload, creatable: creatable}
+}
+
+// decodePayload decodes the payload of a new message of the given type, and validates it
+func decodePayload(typeName string, data []byte) (Payload, *errs.Error) {
+	t, ok := messageTypes[typeName]
+	if !ok || !t.creatable {
+		return nil, errs.ValidationFailed(fmt.Sprintf("messages of type %s cannot be sent", typeName))
+	}
+	payload := t.newPayload()
+	if err := helpers.ParseJSON(bytes.NewReader(data), payload, false); err != nil {
+		return nil, errs.BadRequest(fmt.Sprintf("invalid payload: %s", err))
+	}
+	if appErr := validatePayload(payload); appErr != nil {
+		return nil, appErr
+	}
+	return payload, nil
+}
+
+func validatePayload(payload Payload) *errs.Error {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		return errs.ValidationFailed(fmt.Sprintf("%s", err))
+	}
+	if v, ok := payload.(payloadValidator); ok {
+		if err := v.Validate(); err != nil {
+			return errs.ValidationFailed(err.Error())
+		}
+	}
+	return nil
+}
+
+// storedPayload decodes the payload of a stored message, ok is false if the type is not registered or the payload is invalid
+func storedPayload(typeName string, data []byte) (Payload, bool) {
+	t, ok := messageTypes[typeName]
+	if !ok {
+		return nil, false
+	}
+	payload := t.newPayload()
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, false
+	}
+	return payload, true
+}
+
+// The previews of messages are truncated to atmost maxPreviewLength characters
+const maxPreviewLength = 100
+
+// RenderPreview returns the preview of a stored message, the content of the message is used if its payload cannot be decoded
+func RenderPreview(typeName string, payload []byte, content string) string {
+	preview := content
+	if p, ok := storedPayload(typeName, payload); ok {
+		preview = p.Preview()
+	}
+	runes := []rune(preview)
+	if len(runes) > maxPreviewLength {
+		return string(runes[:maxPreviewLength])
+	}
+	return preview
+}
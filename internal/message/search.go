@@ -0,0 +1,96 @@
+package message
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/go-playground/validator/v10"
+	"github.com/oklog/ulid/v2"
+)
+
+// This file reads the query of a full text search over messages
+// - q is the search query, it supports the web search syntax of postgres, i.e. "quoted phrases", or and -excluded words
+// - sender=<user id> only returns the messages sent by the user
+// - since / until (RFC 3339) only return the messages sent in [since, until)
+// - type only returns the messages of the given type, which must be a registered type
+// Search results are always returned newest first, and only support before=<id> for pagination
+
+type SearchQuery struct {
+	Query    string
+	SenderId *ulid.ULID
+	Since    *time.Time
+	Until    *time.Time
+	Type     string
+	Before   *ulid.ULID
+	Limit    int
+}
+
+func readSearchQuery(u url.Values) (SearchQuery, error) {
+	search := struct {
+		Query  string `validate:"required,max=256"`
+		Sender string `validate:"omitempty,ulid"`
+		Since  string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		Until  string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		Type   string
+		Before string `validate:"omitempty,ulid"`
+	}{
+		Query:  u.Get("q"),
+		Sender: u.Get("sender"),
+		Since:  u.Get("since"),
+		Until:  u.Get("until"),
+		Type:   u.Get("type"),
+		Before: u.Get("before"),
+	}
+	validator := validator.New(validator.WithRequiredStructEnabled())
+	err := validator.Struct(search)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	// The types are registered at runtime, so they cannot be listed in a oneof tag
+	if _, ok := messageTypes[search.Type]; search.Type != "" && !ok {
+		return SearchQuery{}, fmt.Errorf("unknown message type %q", search.Type)
+	}
+	limit, err := helpers.ReadPageLimit(u)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	senderId, err := parseCursorId(search.Sender)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	beforeId, err := parseCursorId(search.Before)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	since, err := parseTime(search.Since)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	until, err := parseTime(search.Until)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	return SearchQuery{
+		Query:    search.Query,
+		SenderId: senderId,
+		Since:    since,
+		Until:    until,
+		Type:     search.Type,
+		Before:   beforeId,
+		Limit:    limit,
+	}, nil
+}
+
+// parseTime parses an optional RFC 3339 timestamp, nil is returned if it is empty
+func parseTime(t string) (*time.Time, error) {
+	if t == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, t)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
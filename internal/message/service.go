@@ -5,26 +5,49 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/ananthvk/gochat/internal/attachment"
 	"github.com/ananthvk/gochat/internal/database"
 	"github.com/ananthvk/gochat/internal/database/db"
 	"github.com/ananthvk/gochat/internal/errs"
 	"github.com/ananthvk/gochat/internal/membership"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/oklog/ulid/v2"
 )
 
-const MessageTypeText = "text"
+// The types of messages, file and image messages reference attachments, system messages record the changes to the group
+const (
+	MessageTypeText   = "text"
+	MessageTypeFile   = "file"
+	MessageTypeImage  = "image"
+	MessageTypePoll   = "poll"
+	MessageTypeSystem = "system"
+)
+
+// The delivery status of a message for a member of the group
+const (
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
 
 type MessageService struct {
 	Db             *database.DatabaseService
 	messageEmitter MessageEmitter
+	editWindow     time.Duration
 }
 
-func NewMessageService(databaseService *database.DatabaseService, emitter MessageEmitter) *MessageService {
+// NewMessageService creates a message service, messages can be edited by their sender within editWindow after they were sent.
+// If editWindow is 0, messages can be edited at any time
+func NewMessageService(databaseService *database.DatabaseService, emitter MessageEmitter, editWindow time.Duration) *MessageService {
 	return &MessageService{
 		Db:             databaseService,
 		messageEmitter: emitter,
+		editWindow:     editWindow,
 	}
 }
 
@@ -45,11 +68,14 @@ func (m *MessageService) GetOne(ctx context.Context, messageId ulid.ULID, groupI
 		}
 		return nil, errs.NotFound("message with the given id not found")
 	}
+	if grp.DeletedAt.Valid {
+		return nil, errs.NotFound("message with the given id not found")
+	}
 	return grp, nil
 }
 
-func (m *MessageService) GetAll(ctx context.Context, pagination Pagination, groupId, userId ulid.ULID) ([]*db.Message, bool, *errs.Error) {
-	hasMoreBefore := false
+// GetAll returns a page of the timeline of the group, newest first, along with the cursor of the page
+func (m *MessageService) GetAll(ctx context.Context, pagination Pagination, groupId, userId ulid.ULID) ([]*db.Message, Cursor, *errs.Error) {
 	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
 	defer cancel()
 
@@ -57,32 +83,116 @@ func (m *MessageService) GetAll(ctx context.Context, pagination Pagination, grou
 	// If membership is valid, it means that the group exist, so no need to check for it separately
 	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
 	if appErr != nil {
-		return nil, hasMoreBefore, appErr
+		return nil, Cursor{}, appErr
 	}
 
-	var beforeBytes []byte
-	if pagination.Before != nil {
-		beforeBytes = pagination.Before[:]
+	var msgs []*db.Message
+	var hasBefore, hasAfter bool
+	var err error
+	switch {
+	case pagination.Around != nil:
+		return m.getAround(ctx, pagination, groupId)
+	case pagination.After != nil:
+		msgs, hasAfter, err = m.getAfter(ctx, groupId, *pagination.After, pagination.Limit)
+		if err == nil {
+			hasBefore, err = m.Db.Queries.HasMessagesInGroupUpTo(ctx, db.HasMessagesInGroupUpToParams{GrpID: groupId[:], UpTo: pagination.After[:]})
+		}
+	default:
+		msgs, hasBefore, err = m.getBefore(ctx, groupId, pagination.Before, pagination.Limit)
+		if err == nil && pagination.Before != nil {
+			hasAfter, err = m.Db.Queries.HasMessagesInGroupFrom(ctx, db.HasMessagesInGroupFromParams{GrpID: groupId[:], From: pagination.Before[:]})
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching messages", "error", err)
+		return nil, Cursor{}, errs.Internal("internal server error while fetching messages")
+	}
+	return msgs, newCursor(msgs, hasBefore, hasAfter), nil
+}
+
+// getAround returns the message, along with limit messages of the timeline on each side of it
+func (m *MessageService) getAround(ctx context.Context, pagination Pagination, groupId ulid.ULID) ([]*db.Message, Cursor, *errs.Error) {
+	anchor, err := m.Db.Queries.GetMessage(ctx, db.GetMessageParams{ID: pagination.Around[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, Cursor{}, errs.Internal("internal server error while fetching messages")
+		}
+		return nil, Cursor{}, errs.NotFound("message with the given id not found")
+	}
+	newer, hasAfter, err := m.getAfter(ctx, groupId, *pagination.Around, pagination.Limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching messages", "error", err)
+		return nil, Cursor{}, errs.Internal("internal server error while fetching messages")
+	}
+	older, hasBefore, err := m.getBefore(ctx, groupId, pagination.Around, pagination.Limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching messages", "error", err)
+		return nil, Cursor{}, errs.Internal("internal server error while fetching messages")
+	}
+
+	msgs := newer
+	// Replies in a thread are not part of the timeline, only the messages around the reply are returned
+	if anchor.ThreadRootID == nil {
+		msgs = append(msgs, anchor)
 	}
+	msgs = append(msgs, older...)
+	return msgs, newCursor(msgs, hasBefore, hasAfter), nil
+}
 
-	grps, err := m.Db.Queries.GetMessagesInGroup(ctx, db.GetMessagesInGroupParams{
+// getBefore returns upto limit messages of the timeline before the given message (or the latest messages if before is nil),
+// newest first, and whether there are more messages before them
+func (m *MessageService) getBefore(ctx context.Context, groupId ulid.ULID, before *ulid.ULID, limit int) ([]*db.Message, bool, error) {
+	var beforeBytes []byte
+	if before != nil {
+		beforeBytes = before[:]
+	}
+	msgs, err := m.Db.Queries.GetMessagesInGroup(ctx, db.GetMessagesInGroupParams{
 		GrpID:  groupId[:],
 		Before: beforeBytes,
-		Limit:  int32(pagination.Limit + 1),
+		Limit:  int32(limit + 1),
 	})
 	if err != nil {
-		slog.Error("internal server error", "errror", err.Error())
-		return nil, hasMoreBefore, errs.Internal("internal server error while fetching messages")
+		return nil, false, err
 	}
-
 	// If we could retrieve limit + 1 rows, it means that hasBefore should be set to true
-	if len(grps) == (pagination.Limit + 1) {
-		hasMoreBefore = true
-		grps = grps[:pagination.Limit]
+	if len(msgs) == (limit + 1) {
+		return msgs[:limit], true, nil
+	}
+	return msgs, false, nil
+}
+
+// getAfter returns upto limit messages of the timeline after the given message, newest first, and whether there are more
+// messages after them
+func (m *MessageService) getAfter(ctx context.Context, groupId, after ulid.ULID, limit int) ([]*db.Message, bool, error) {
+	msgs, err := m.Db.Queries.GetMessagesInGroupAfter(ctx, db.GetMessagesInGroupAfterParams{
+		GrpID: groupId[:],
+		After: after[:],
+		Limit: int32(limit + 1),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	hasAfter := false
+	if len(msgs) == (limit + 1) {
+		hasAfter = true
+		msgs = msgs[:limit]
 	}
-	return grps, hasMoreBefore, nil
+	// The messages closest to after are fetched first, they are reversed so that the newest message is first
+	slices.Reverse(msgs)
+	return msgs, hasAfter, nil
 }
 
+// Actions recorded in the moderation log of a group
+const (
+	ModerationMessageDeleted = "message_deleted"
+	ModerationMessagePurged  = "message_purged"
+)
+
+// Delete soft deletes the message, the message is kept as a tombstone without its content. Only the sender of the message or the
+// owner of the group can delete a message, if the owner deletes the message of another member, it is recorded in the moderation log.
+// The last message and the message count of the group are updated in the same transaction, and the connected clients of the group
+// are notified about the deletion
 func (m *MessageService) Delete(ctx context.Context, messageId, groupId, userId ulid.ULID) *errs.Error {
 	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
 	defer cancel()
@@ -91,17 +201,178 @@ func (m *MessageService) Delete(ctx context.Context, messageId, groupId, userId
 	if appErr != nil {
 		return appErr
 	}
-	err := m.Db.Queries.DeleteMessage(ctx, db.DeleteMessageParams{ID: messageId[:], GrpID: groupId[:]})
+	grp, appErr := membership.GetGroup(m.Db, ctx, groupId)
+	if appErr != nil {
+		return appErr
+	}
+
+	tx, err := m.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting message", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := m.Db.Queries.WithTx(tx)
+
+	existing, err := qtx.GetMessageForUpdate(ctx, db.GetMessageForUpdateParams{ID: messageId[:], GrpID: groupId[:]})
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			slog.ErrorContext(ctx, "internal error while deleting message", "error", err)
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
 			return errs.Internal("internal server error while deleting message")
 		}
+		// The message does not exist, idempotent behavior
+		return nil
+	}
+	if existing.DeletedAt.Valid {
+		return nil
+	}
+	if existing.Type == MessageTypeSystem {
+		return errs.BadRequest("system messages cannot be deleted")
+	}
+	isSender := ulid.ULID(existing.SenderID) == userId
+	if !isSender && ulid.ULID(grp.OwnerID) != userId {
+		return errs.NotAuthorized("only the sender of the message or the owner of the group can delete it")
+	}
+
+	message, err := qtx.SoftDeleteMessage(ctx, db.SoftDeleteMessageParams{DeletedBy: userId[:], ID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting message", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	// The previous versions of the message should not outlive the message
+	if err := qtx.DeleteMessageRevisions(ctx, message.ID); err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting message revisions", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	if err := qtx.DeleteReactionsOfMessage(ctx, message.ID); err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting message reactions", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	if _, err := qtx.DeleteMentionsOfMessage(ctx, message.ID); err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting mentions", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	// The blobs of the attachments are removed from the blob store by the sweeper of the attachment service
+	if err := qtx.DeleteAttachmentsOfMessage(ctx, message.ID); err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting attachments", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	if appErr := refreshCounts(ctx, qtx, message); appErr != nil {
+		return appErr
+	}
+	if !isSender {
+		if appErr := logModeration(ctx, qtx, groupId, userId, ModerationMessageDeleted, message); appErr != nil {
+			return appErr
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting message", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+
+	m.emit(groupId, "message_deleted", messageResponse(message))
+	return nil
+}
+
+// refreshCounts updates the last message, the message count and the unread counts of the group after the message has been
+// deleted, or the reply count of its thread if the message is a reply in a thread
+func refreshCounts(ctx context.Context, qtx *db.Queries, message *db.Message) *errs.Error {
+	var err error
+	if message.ThreadRootID == nil {
+		err = qtx.RefreshGroupLastMessage(ctx, message.GrpID)
+		if err == nil {
+			err = qtx.DecrementUnreadCounts(ctx, db.DecrementUnreadCountsParams{
+				GrpID:     message.GrpID,
+				SenderID:  message.SenderID,
+				MessageID: message.ID,
+			})
+		}
+	} else {
+		err = qtx.RefreshThread(ctx, message.ThreadRootID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while refreshing message counts", "error", err)
+		return errs.Internal("internal server error while deleting message")
+	}
+	return nil
+}
+
+// logModeration records a moderation action on a message in the moderation log of the group
+func logModeration(ctx context.Context, qtx *db.Queries, groupId, actorId ulid.ULID, action string, message *db.Message) *errs.Error {
+	id := ulid.Make()
+	err := qtx.CreateModerationLogEntry(ctx, db.CreateModerationLogEntryParams{
+		ID:          id[:],
+		GrpID:       groupId[:],
+		ActorID:     actorId[:],
+		Action:      action,
+		MessageID:   message.ID,
+		TargetUsrID: message.SenderID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while writing moderation log", "error", err)
+		return errs.Internal("internal server error while writing moderation log")
+	}
+	return nil
+}
+
+// Purge permanently deletes the message along with its revisions, only the owner and admins of the group can do this.
+// Unlike Delete, no tombstone is left behind. Purges are always recorded in the moderation log
+func (m *MessageService) Purge(ctx context.Context, messageId, groupId, userId ulid.ULID) *errs.Error {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	_, appErr := membership.Authorize(m.Db, ctx, groupId, userId, membership.ActionPurgeMessages)
+	if appErr != nil {
+		return appErr
+	}
+
+	tx, err := m.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while purging message", "error", err)
+		return errs.Internal("internal server error while purging message")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := m.Db.Queries.WithTx(tx)
+
+	message, err := qtx.GetMessageForUpdate(ctx, db.GetMessageForUpdateParams{ID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return errs.Internal("internal server error while purging message")
+		}
+		return errs.NotFound("message with the given id not found")
+	}
+	_, err = qtx.DeleteMessage(ctx, db.DeleteMessageParams{ID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while purging message", "error", err)
+		return errs.Internal("internal server error while purging message")
+	}
+	// Soft deleted messages have already been removed from the message count
+	if !message.DeletedAt.Valid {
+		if appErr := refreshCounts(ctx, qtx, message); appErr != nil {
+			return appErr
+		}
 	}
+	if appErr := logModeration(ctx, qtx, groupId, userId, ModerationMessagePurged, message); appErr != nil {
+		return appErr
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while purging message", "error", err)
+		return errs.Internal("internal server error while purging message")
+	}
+
+	m.emit(groupId, "message_purged", messageEventPayload{Id: messageId.String(), GrpId: groupId.String()})
 	return nil
 }
 
-func (m *MessageService) Create(ctx context.Context, messageType string, content string, groupId, userId ulid.ULID) (*db.Message, *errs.Error) {
+// Create sends a message to the group. If reply_to_id is set, the message is a reply to that message, which must be a message of
+// the same group that has not been deleted. If thread_root_id is set, the message is posted in the thread started by that message
+// instead of the timeline of the group, and it is broadcast as a thread_message event
+func (m *MessageService) Create(ctx context.Context, req MessageCreateRequest, groupId, userId ulid.ULID) (*db.Message, *errs.Error) {
 	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
 	defer cancel()
 	id := ulid.Make()
@@ -110,39 +381,733 @@ func (m *MessageService) Create(ctx context.Context, messageType string, content
 	if appErr != nil {
 		return nil, appErr
 	}
+	data, err := req.payload()
+	if err != nil {
+		return nil, errs.BadRequest(err.Error())
+	}
+	payload, appErr := decodePayload(req.Type, data)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	tx, err := m.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating message", "error", err)
+		return nil, errs.Internal("internal server error while creating message")
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := m.Db.Queries.WithTx(tx)
+
+	var attachmentIds [][]byte
+	if withAttachments, ok := payload.(attachmentPayload); ok {
+		for _, attachmentId := range withAttachments.AttachmentIds() {
+			parsed, err := ulid.Parse(attachmentId)
+			if err != nil {
+				return nil, errs.BadRequest("invalid attachment_ids")
+			}
+			attachmentIds = append(attachmentIds, parsed[:])
+		}
+	}
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while encoding message payload", "error", err)
+		return nil, errs.Internal("internal server error while creating message")
+	}
+
+	var replyTo *db.GetMessagePreviewsRow
+	var replyToId []byte
+	if req.ReplyToId != "" {
+		parentId, err := ulid.Parse(req.ReplyToId)
+		if err != nil {
+			return nil, errs.BadRequest("invalid reply_to_id")
+		}
+		previews, err := qtx.GetMessagePreviews(ctx, [][]byte{parentId[:]})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, errs.Internal("internal server error while creating message")
+		}
+		if len(previews) == 0 || ulid.ULID(previews[0].GrpID) != groupId {
+			return nil, errs.BadRequest("reply_to_id must refer to a message in the same group")
+		}
+		if previews[0].DeletedAt.Valid {
+			return nil, errs.BadRequest("cannot reply to a deleted message")
+		}
+		replyTo = previews[0]
+		replyToId = parentId[:]
+	}
 
-	message, err := m.Db.Queries.CreateMessage(ctx, db.CreateMessageParams{
-		Type:     messageType,
-		Content:  content,
-		ID:       id[:],
-		GrpID:    groupId[:],
-		SenderID: userId[:],
+	var threadRootId []byte
+	if req.ThreadRootId != "" {
+		rootId, err := ulid.Parse(req.ThreadRootId)
+		if err != nil {
+			return nil, errs.BadRequest("invalid thread_root_id")
+		}
+		root, err := qtx.GetMessage(ctx, db.GetMessageParams{ID: rootId[:], GrpID: groupId[:]})
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+				return nil, errs.Internal("internal server error while creating message")
+			}
+			return nil, errs.BadRequest("thread_root_id must refer to a message in the same group")
+		}
+		if root.DeletedAt.Valid {
+			return nil, errs.BadRequest("cannot reply in the thread of a deleted message")
+		}
+		// Threads cannot be nested
+		if root.ThreadRootID != nil {
+			return nil, errs.BadRequest("cannot start a thread from a reply in a thread")
+		}
+		threadRootId = root.ID
+	}
+
+	message, err := qtx.CreateMessage(ctx, db.CreateMessageParams{
+		Type:         req.Type,
+		Content:      payload.Text(),
+		Payload:      payloadData,
+		ID:           id[:],
+		GrpID:        groupId[:],
+		SenderID:     userId[:],
+		ReplyToID:    replyToId,
+		ThreadRootID: threadRootId,
 	})
 	if err != nil {
 		slog.ErrorContext(ctx, "internal error while creating message", "error", err)
 		return nil, errs.Internal("internal server error while creating message")
 	}
+	var attachments []*db.Attachment
+	if len(attachmentIds) > 0 {
+		attachments, err = qtx.AttachToMessage(ctx, db.AttachToMessageParams{
+			MessageID:  message.ID,
+			Ids:        attachmentIds,
+			GrpID:      groupId[:],
+			UploaderID: userId[:],
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while attaching attachments", "error", err)
+			return nil, errs.Internal("internal server error while creating message")
+		}
+		if len(attachments) != len(attachmentIds) {
+			return nil, errs.BadRequest("attachment_ids must refer to attachments uploaded by the sender to the group, which have not been sent")
+		}
+		for _, attached := range attachments {
+			if !payload.(attachmentPayload).AcceptsAttachment(attached.ContentType) {
+				return nil, errs.BadRequest(fmt.Sprintf("messages of type %s cannot have attachments of type %s", req.Type, attached.ContentType))
+			}
+		}
+	}
+	mentions, err := findMentions(ctx, qtx, groupId, message.Content)
+	if err == nil {
+		err = storeMentions(ctx, qtx, message.ID, mentions)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while storing mentions", "error", err)
+		return nil, errs.Internal("internal server error while creating message")
+	}
+	var thread *db.AddThreadReplyRow
+	if threadRootId == nil {
+		err = qtx.UpdateGroupLastMessage(ctx, db.UpdateGroupLastMessageParams{
+			LastMessageID: message.ID,
+			LastMessageAt: message.CreatedAt,
+			ID:            groupId[:],
+		})
+		if err == nil {
+			err = qtx.IncrementUnreadCounts(ctx, db.IncrementUnreadCountsParams{GrpID: groupId[:], SenderID: userId[:]})
+		}
+	} else {
+		thread, err = qtx.AddThreadReply(ctx, db.AddThreadReplyParams{LastReplyAt: message.CreatedAt, ID: threadRootId})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating message", "error", err)
+		return nil, errs.Internal("internal server error while creating message")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while creating message", "error", err)
+		return nil, errs.Internal("internal server error while creating message")
+	}
 	// Broadcast the message
+	resp := messageResponse(message)
+	resp.Entities = mentionEntities(mentions)
+	for _, attached := range attachments {
+		resp.Attachments = append(resp.Attachments, attachment.Response(attached))
+	}
+	if replyTo != nil {
+		resp.ReplyTo = messagePreviewResponse(replyTo)
+	}
+	if poll, ok := payload.(*PollPayload); ok {
+		resp.Poll = pollResults(poll, nil, nil)
+	}
+	if thread == nil {
+		m.emit(groupId, "text_message", resp)
+	} else {
+		m.emit(groupId, "thread_message", threadEventPayload{
+			Message:     resp,
+			ReplyCount:  thread.ReplyCount,
+			LastReplyAt: thread.LastReplyAt.Time,
+		})
+	}
+	// The mentioned users are notified on all their connections, even if they are not viewing the group
+	for _, mentionedId := range mentionedUsers(mentions, userId) {
+		m.emitToUser(mentionedId, "mention", resp)
+	}
+	return message, nil
+}
+
+// GetThread returns the replies in the thread started by the given message, newest first
+func (m *MessageService) GetThread(ctx context.Context, pagination Pagination, messageId, groupId, userId ulid.ULID) ([]*db.Message, bool, *errs.Error) {
+	hasMoreBefore := false
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return nil, hasMoreBefore, appErr
+	}
+	// The thread of a deleted message can still be viewed
+	_, err := m.Db.Queries.GetMessage(ctx, db.GetMessageParams{ID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, hasMoreBefore, errs.Internal("internal server error while fetching thread")
+		}
+		return nil, hasMoreBefore, errs.NotFound("message with the given id not found")
+	}
+
+	var beforeBytes []byte
+	if pagination.Before != nil {
+		beforeBytes = pagination.Before[:]
+	}
+	msgs, err := m.Db.Queries.GetThreadMessages(ctx, db.GetThreadMessagesParams{
+		ThreadRootID: messageId[:],
+		GrpID:        groupId[:],
+		Before:       beforeBytes,
+		Limit:        int32(pagination.Limit + 1),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching thread", "error", err)
+		return nil, hasMoreBefore, errs.Internal("internal server error while fetching thread")
+	}
+
+	if len(msgs) == (pagination.Limit + 1) {
+		hasMoreBefore = true
+		msgs = msgs[:pagination.Limit]
+	}
+	return msgs, hasMoreBefore, nil
+}
+
+// Edit replaces the content of a message, only the sender of the message can edit it. The previous content is stored as a revision
+// of the message, and the connected clients of the group are notified about the edit
+func (m *MessageService) Edit(ctx context.Context, messageId, groupId, userId ulid.ULID, content string) (*db.Message, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
 
-	type messageBroadcast struct {
-		Type    string `json:"type"`
-		Payload any    `json:"payload"`
+	tx, err := m.Db.Pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while editing message", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
 	}
+	defer tx.Rollback(ctx)
 
-	msg := MessageResponse{
-		Id:        ulid.ULID(message.ID[:]).String(),
-		CreatedAt: message.CreatedAt.Time,
-		Type:      message.Type,
+	qtx := m.Db.Queries.WithTx(tx)
+
+	message, err := qtx.GetMessageForUpdate(ctx, db.GetMessageForUpdateParams{ID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, errs.Internal("internal server error while editing message")
+		}
+		return nil, errs.NotFound("message with the given id not found")
+	}
+	if message.DeletedAt.Valid {
+		return nil, errs.NotFound("message with the given id not found")
+	}
+	if message.Type == MessageTypeSystem {
+		return nil, errs.BadRequest("system messages cannot be edited")
+	}
+	if ulid.ULID(message.SenderID) != userId {
+		return nil, errs.NotAuthorized("only the sender of the message can edit it")
+	}
+	if m.editWindow > 0 && time.Since(message.CreatedAt.Time) > m.editWindow {
+		return nil, errs.NotAuthorized("the message can no longer be edited")
+	}
+	payload, ok := storedPayload(message.Type, message.Payload)
+	editable, isEditable := payload.(editablePayload)
+	if !ok || !isEditable {
+		return nil, errs.BadRequest(fmt.Sprintf("messages of type %s cannot be edited", message.Type))
+	}
+	if message.Content == content {
+		// Nothing has changed, do not create a revision
+		return message, nil
+	}
+	editable.SetText(content)
+	if appErr := validatePayload(editable); appErr != nil {
+		return nil, appErr
+	}
+	payloadData, err := json.Marshal(editable)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while encoding message payload", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
+	}
+
+	revisionId := ulid.Make()
+	err = qtx.CreateMessageRevision(ctx, db.CreateMessageRevisionParams{
+		ID:        revisionId[:],
+		MessageID: message.ID,
 		Content:   message.Content,
-		GrpId:     ulid.ULID(message.GrpID).String(),
-		SenderId:  ulid.ULID(message.SenderID).String(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while creating message revision", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
+	}
+	message, err = qtx.UpdateMessageContent(ctx, db.UpdateMessageContentParams{Content: content, Payload: payloadData, ID: message.ID})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while editing message", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
+	}
+	// The mentions are parsed again from the new content, only the users who were not mentioned before are notified
+	previous, err := qtx.DeleteMentionsOfMessage(ctx, message.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while deleting mentions", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
+	}
+	mentions, err := findMentions(ctx, qtx, groupId, message.Content)
+	if err == nil {
+		err = storeMentions(ctx, qtx, message.ID, mentions)
 	}
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while storing mentions", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "internal error while editing message", "error", err)
+		return nil, errs.Internal("internal server error while editing message")
+	}
+
+	resp := messageResponse(message)
+	resp.Entities = mentionEntities(mentions)
+	m.emit(groupId, "message_edited", resp)
+	notified := make(map[ulid.ULID]bool, len(previous))
+	for _, usrId := range previous {
+		notified[ulid.ULID(usrId)] = true
+	}
+	for _, mentionedId := range mentionedUsers(mentions, userId) {
+		if !notified[mentionedId] {
+			m.emitToUser(mentionedId, "mention", resp)
+		}
+	}
+	return message, nil
+}
+
+// GetRevisions returns the previous versions of a message, newest first
+func (m *MessageService) GetRevisions(ctx context.Context, messageId, groupId, userId ulid.ULID) ([]*db.MessageRevision, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
 
-	data, err := json.Marshal(messageBroadcast{Type: "text_message", Payload: msg})
+	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	_, err := m.Db.Queries.GetMessage(ctx, db.GetMessageParams{ID: messageId[:], GrpID: groupId[:]})
 	if err != nil {
-		panic("could not marshal json")
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return nil, errs.Internal("internal server error while fetching message")
+		}
+		return nil, errs.NotFound("message with the given id not found")
+	}
+	revisions, err := m.Db.Queries.GetMessageRevisions(ctx, messageId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching message revisions", "error", err)
+		return nil, errs.Internal("internal server error while fetching message revisions")
+	}
+	return revisions, nil
+}
+
+// AddReaction reacts to the message with the given emoji, reacting again with the same emoji has no effect.
+// A reaction_added event is broadcast to the group if the reaction was added
+func (m *MessageService) AddReaction(ctx context.Context, messageId, groupId, userId ulid.ULID, emoji string) *errs.Error {
+	// Also checks that the user is a member of the group, and that the message has not been deleted
+	_, appErr := m.GetOne(ctx, messageId, groupId, userId)
+	if appErr != nil {
+		return appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.Db.Queries.AddReaction(ctx, db.AddReactionParams{MessageID: messageId[:], UsrID: userId[:], Emoji: emoji})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while adding reaction", "error", err)
+		return errs.Internal("internal server error while adding reaction")
+	}
+	if rows > 0 {
+		m.emit(groupId, "reaction_added", reactionEventPayload{
+			MessageId: messageId.String(),
+			GrpId:     groupId.String(),
+			UserId:    userId.String(),
+			Emoji:     emoji,
+		})
+	}
+	return nil
+}
+
+// RemoveReaction removes the reaction of the user with the given emoji, it is not an error if the user has not reacted with it.
+// A reaction_removed event is broadcast to the group if a reaction was removed
+func (m *MessageService) RemoveReaction(ctx context.Context, messageId, groupId, userId ulid.ULID, emoji string) *errs.Error {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return appErr
+	}
+
+	rows, err := m.Db.Queries.RemoveReaction(ctx, db.RemoveReactionParams{MessageID: messageId[:], UsrID: userId[:], Emoji: emoji})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while removing reaction", "error", err)
+		return errs.Internal("internal server error while removing reaction")
+	}
+	if rows > 0 {
+		m.emit(groupId, "reaction_removed", reactionEventPayload{
+			MessageId: messageId.String(),
+			GrpId:     groupId.String(),
+			UserId:    userId.String(),
+			Emoji:     emoji,
+		})
+	}
+	return nil
+}
+
+// GetReactions returns the individual reactions to a message, oldest first
+func (m *MessageService) GetReactions(ctx context.Context, messageId, groupId, userId ulid.ULID) ([]*db.GetReactionsOfMessageRow, *errs.Error) {
+	_, appErr := m.GetOne(ctx, messageId, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	reactions, err := m.Db.Queries.GetReactionsOfMessage(ctx, messageId[:])
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching reactions", "error", err)
+		return nil, errs.Internal("internal server error while fetching reactions")
+	}
+	return reactions, nil
+}
+
+// describe converts the messages to responses as seen by the given user. The previews of the messages they reply to, and
+// the reaction counts are fetched in a single query each
+func (m *MessageService) describe(ctx context.Context, msgs []*db.Message, userId ulid.ULID) ([]MessageResponse, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	resp := make([]MessageResponse, len(msgs))
+	messageIds := make([][]byte, len(msgs))
+	indexById := make(map[ulid.ULID]int, len(msgs))
+	var parentIds [][]byte
+	for i, message := range msgs {
+		resp[i] = messageResponse(message)
+		messageIds[i] = message.ID
+		indexById[ulid.ULID(message.ID)] = i
+		if message.ReplyToID != nil {
+			parentIds = append(parentIds, message.ReplyToID)
+		}
+	}
+	if len(msgs) == 0 {
+		return resp, nil
+	}
+
+	counts, err := m.Db.Queries.GetReactionCounts(ctx, db.GetReactionCountsParams{UsrID: userId[:], MessageIds: messageIds})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching reaction counts", "error", err)
+		return nil, errs.Internal("internal server error while fetching messages")
+	}
+	for _, count := range counts {
+		i := indexById[ulid.ULID(count.MessageID)]
+		resp[i].Reactions = append(resp[i].Reactions, ReactionCountResponse{
+			Emoji:   count.Emoji,
+			Count:   count.Count,
+			Reacted: count.Reacted,
+		})
 	}
 
+	mentions, err := m.Db.Queries.GetMentionsOfMessages(ctx, messageIds)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching mentions", "error", err)
+		return nil, errs.Internal("internal server error while fetching messages")
+	}
+	for _, mention := range mentions {
+		i := indexById[ulid.ULID(mention.MessageID)]
+		resp[i].Entities = append(resp[i].Entities, MessageEntityResponse{
+			Type:     MessageEntityMention,
+			Offset:   mention.StartOffset,
+			Length:   mention.Length,
+			UserId:   ulid.ULID(mention.UsrID).String(),
+			Username: mention.Username,
+		})
+	}
+
+	attachments, err := m.Db.Queries.GetAttachmentsOfMessages(ctx, messageIds)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching attachments", "error", err)
+		return nil, errs.Internal("internal server error while fetching messages")
+	}
+	for _, attached := range attachments {
+		i := indexById[ulid.ULID(attached.MessageID)]
+		// The attachments of deleted messages are no longer available
+		if msgs[i].DeletedAt.Valid {
+			continue
+		}
+		resp[i].Attachments = append(resp[i].Attachments, attachment.Response(attached))
+	}
+
+	var pollIds [][]byte
+	for _, message := range msgs {
+		if message.Type == MessageTypePoll && !message.DeletedAt.Valid {
+			pollIds = append(pollIds, message.ID)
+		}
+	}
+	if len(pollIds) > 0 {
+		votes, err := m.Db.Queries.GetPollVotes(ctx, pollIds)
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while fetching votes", "error", err)
+			return nil, errs.Internal("internal server error while fetching messages")
+		}
+		votesById := map[ulid.ULID][]*db.PollVote{}
+		for _, vote := range votes {
+			votesById[ulid.ULID(vote.MessageID)] = append(votesById[ulid.ULID(vote.MessageID)], vote)
+		}
+		for _, pollId := range pollIds {
+			i := indexById[ulid.ULID(pollId)]
+			if poll, ok := storedPayload(msgs[i].Type, msgs[i].Payload); ok {
+				resp[i].Poll = pollResults(poll.(*PollPayload), votesById[ulid.ULID(pollId)], &userId)
+			}
+		}
+	}
+
+	if len(parentIds) == 0 {
+		return resp, nil
+	}
+
+	previews, err := m.Db.Queries.GetMessagePreviews(ctx, parentIds)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching message previews", "error", err)
+		return nil, errs.Internal("internal server error while fetching messages")
+	}
+	previewById := make(map[ulid.ULID]*db.GetMessagePreviewsRow, len(previews))
+	for _, preview := range previews {
+		previewById[ulid.ULID(preview.ID)] = preview
+	}
+	for i, message := range msgs {
+		if message.ReplyToID == nil {
+			continue
+		}
+		if preview, ok := previewById[ulid.ULID(message.ReplyToID)]; ok {
+			resp[i].ReplyTo = messagePreviewResponse(preview)
+		}
+	}
+	return resp, nil
+}
+
+// MarkStatus marks all the messages of the group up to (and including) the given message as delivered or read by the user, and
+// returns the number of messages whose status has changed. The senders of those messages receive a message_status event on all
+// their connections. When messages are read, the read marker of the user in the group also moves forward to the message (unless
+// it is a reply in a thread), and all the connections of the user receive a read_marker event, so that they stay in sync
+func (m *MessageService) MarkStatus(ctx context.Context, messageId, groupId, userId ulid.ULID, status string) (int, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return 0, appErr
+	}
+	message, err := m.Db.Queries.GetMessage(ctx, db.GetMessageParams{ID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "internal error while fetching message", "error", err)
+			return 0, errs.Internal("internal server error while updating message status")
+		}
+		return 0, errs.NotFound("message with the given id not found")
+	}
+
+	marked, err := m.Db.Queries.MarkMessagesUpTo(ctx, db.MarkMessagesUpToParams{
+		UsrID:  userId[:],
+		Status: status,
+		GrpID:  groupId[:],
+		UpTo:   messageId[:],
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while updating message status", "error", err)
+		return 0, errs.Internal("internal server error while updating message status")
+	}
+
+	// Each sender is notified once about all of their messages
+	messageIdsBySender := map[ulid.ULID][]string{}
+	for _, row := range marked {
+		senderId := ulid.ULID(row.SenderID)
+		messageIdsBySender[senderId] = append(messageIdsBySender[senderId], ulid.ULID(row.MessageID).String())
+	}
+	for senderId, messageIds := range messageIdsBySender {
+		m.emitToUser(senderId, "message_status", statusEventPayload{
+			GrpId:      groupId.String(),
+			UserId:     userId.String(),
+			Status:     status,
+			MessageIds: messageIds,
+		})
+	}
+
+	if status == MessageStatusRead && message.ThreadRootID == nil {
+		advanced, err := m.Db.Queries.AdvanceLastReadMessage(ctx, db.AdvanceLastReadMessageParams{
+			LastReadMessageID: messageId[:],
+			GrpID:             groupId[:],
+			UsrID:             userId[:],
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "internal error while updating read marker", "error", err)
+			return 0, errs.Internal("internal server error while updating message status")
+		}
+		if advanced > 0 {
+			m.emitToUser(userId, "read_marker", readMarkerEventPayload{GrpId: groupId.String(), LastReadMessageId: messageId.String()})
+		}
+	}
+	return len(marked), nil
+}
+
+// HandleMarkReadFrame handles a mark_read frame sent over the websocket, it is equivalent to POST .../message/{message_id}/read
+func (m *MessageService) HandleMarkReadFrame(ctx context.Context, userId ulid.ULID, payload json.RawMessage) *errs.Error {
+	frame := MarkReadFrame{}
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		return errs.BadRequest("invalid mark_read frame")
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(frame); err != nil {
+		return errs.ValidationFailed(err.Error())
+	}
+	groupId, err := ulid.Parse(frame.GrpId)
+	if err != nil {
+		return errs.InvalidID("invalid group_id")
+	}
+	messageId, err := ulid.Parse(frame.MessageId)
+	if err != nil {
+		return errs.InvalidID("invalid message_id")
+	}
+	_, appErr := m.MarkStatus(ctx, messageId, groupId, userId, MessageStatusRead)
+	return appErr
+}
+
+// GetStatuses returns the delivery and read status of the message for each member of the group who has received it
+func (m *MessageService) GetStatuses(ctx context.Context, messageId, groupId, userId ulid.ULID) ([]*db.GetMessageStatusesRow, *errs.Error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	appErr := membership.IsUserMemberOfGroup(m.Db, ctx, groupId, userId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	statuses, err := m.Db.Queries.GetMessageStatuses(ctx, db.GetMessageStatusesParams{MessageID: messageId[:], GrpID: groupId[:]})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching message status", "error", err)
+		return nil, errs.Internal("internal server error while fetching message status")
+	}
+	return statuses, nil
+}
+
+// GetMentions returns the messages in which the user has been mentioned, newest first, and whether there are more messages
+// before them
+func (m *MessageService) GetMentions(ctx context.Context, pagination Pagination, userId ulid.ULID) ([]*db.Message, bool, *errs.Error) {
+	hasMoreBefore := false
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	var beforeBytes []byte
+	if pagination.Before != nil {
+		beforeBytes = pagination.Before[:]
+	}
+	msgs, err := m.Db.Queries.GetMentionsOfUser(ctx, db.GetMentionsOfUserParams{
+		UsrID:  userId[:],
+		Before: beforeBytes,
+		Limit:  int32(pagination.Limit + 1),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while fetching mentions", "error", err)
+		return nil, hasMoreBefore, errs.Internal("internal server error while fetching mentions")
+	}
+	if len(msgs) == (pagination.Limit + 1) {
+		hasMoreBefore = true
+		msgs = msgs[:pagination.Limit]
+	}
+	return msgs, hasMoreBefore, nil
+}
+
+// Search returns the messages matching a full text search, newest first, and whether there are more results before them.
+// If groupId is nil, the messages of all the groups the user is a member of are searched
+func (m *MessageService) Search(ctx context.Context, query SearchQuery, groupId *ulid.ULID, userId ulid.ULID) ([]*db.SearchMessagesRow, bool, *errs.Error) {
+	hasMoreBefore := false
+	ctx, cancel := context.WithTimeout(ctx, m.Db.QueryTimeout)
+	defer cancel()
+
+	params := db.SearchMessagesParams{
+		Query: query.Query,
+		UsrID: userId[:],
+		Limit: int32(query.Limit + 1),
+	}
+	if groupId != nil {
+		appErr := membership.IsUserMemberOfGroup(m.Db, ctx, *groupId, userId)
+		if appErr != nil {
+			return nil, hasMoreBefore, appErr
+		}
+		params.GrpID = groupId[:]
+	}
+	if query.SenderId != nil {
+		params.SenderID = query.SenderId[:]
+	}
+	if query.Since != nil {
+		params.Since = pgtype.Timestamptz{Time: *query.Since, Valid: true}
+	}
+	if query.Until != nil {
+		params.Until = pgtype.Timestamptz{Time: *query.Until, Valid: true}
+	}
+	if query.Type != "" {
+		params.Type = pgtype.Text{String: query.Type, Valid: true}
+	}
+	if query.Before != nil {
+		params.Before = query.Before[:]
+	}
+
+	results, err := m.Db.Queries.SearchMessages(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "internal error while searching messages", "error", err)
+		return nil, hasMoreBefore, errs.Internal("internal server error while searching messages")
+	}
+	if len(results) == (query.Limit + 1) {
+		hasMoreBefore = true
+		results = results[:query.Limit]
+	}
+	return results, hasMoreBefore, nil
+}
+
+// emit broadcasts an event to the connected clients of the group
+func (m *MessageService) emit(groupId ulid.ULID, eventType string, payload any) {
+	data, err := json.Marshal(messageEvent{Type: eventType, Payload: payload})
+	if err != nil {
+		panic("could not marshal json")
+	}
 	m.messageEmitter.Broadcast(groupId, data)
-	return message, nil
+}
+
+// emitToUser sends an event to all the connected clients of the user
+func (m *MessageService) emitToUser(userId ulid.ULID, eventType string, payload any) {
+	data, err := json.Marshal(messageEvent{Type: eventType, Payload: payload})
+	if err != nil {
+		panic("could not marshal json")
+	}
+	m.messageEmitter.SendToUser(userId, data)
 }
@@ -0,0 +1,90 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ananthvk/gochat/internal/database/db"
+	"github.com/oklog/ulid/v2"
+)
+
+// System messages record the changes to a group in its timeline, they are created by the server in the same transaction as the
+// change, and cannot be sent, edited or deleted by members. System messages do not have a sender, the user who made the change
+// is kept in the payload, so that the user can still be deleted
+
+// The events recorded by system messages
+const (
+	SystemMemberJoined       = "member_joined"
+	SystemMemberLeft         = "member_left"
+	SystemMemberRemoved      = "member_removed"
+	SystemGroupRenamed       = "group_renamed"
+	SystemDescriptionChanged = "description_changed"
+)
+
+// SystemPayload is the payload of a system message, ActorId is the user who made the change, UserId is the member who was
+// removed, Name and PreviousName are set when the group is renamed
+type SystemPayload struct {
+	Event        string `json:"event"`
+	ActorId      string `json:"actor_id"`
+	UserId       string `json:"user_id,omitempty"`
+	Name         string `json:"name,omitempty"`
+	PreviousName string `json:"previous_name,omitempty"`
+}
+
+func (p *SystemPayload) Text() string { return "" }
+
+func (p *SystemPayload) Preview() string {
+	switch p.Event {
+	case SystemMemberJoined:
+		return "A member joined the group"
+	case SystemMemberLeft:
+		return "A member left the group"
+	case SystemMemberRemoved:
+		return "A member was removed from the group"
+	case SystemGroupRenamed:
+		return "The group was renamed to " + p.Name
+	case SystemDescriptionChanged:
+		return "The description of the group was changed"
+	}
+	return "The group was updated"
+}
+
+// CreateSystemMessage creates a system message in the group, q should be bound to the transaction of the change, so that the
+// message is only stored if the change is committed. The message becomes the last message of the group
+func CreateSystemMessage(ctx context.Context, q *db.Queries, groupId, actorId ulid.ULID, payload *SystemPayload) (*db.Message, error) {
+	payload.ActorId = actorId.String()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	id := ulid.Make()
+	message, err := q.CreateMessage(ctx, db.CreateMessageParams{
+		Type:    MessageTypeSystem,
+		Content: payload.Text(),
+		Payload: data,
+		ID:      id[:],
+		GrpID:   groupId[:],
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = q.UpdateGroupLastMessage(ctx, db.UpdateGroupLastMessageParams{
+		LastMessageID: message.ID,
+		LastMessageAt: message.CreatedAt,
+		ID:            groupId[:],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// BroadcastSystemMessage sends a system message to the connected clients of its group as a system_message event, it should be
+// called after the transaction of the message has been committed
+func BroadcastSystemMessage(emitter MessageEmitter, message *db.Message) {
+	data, err := json.Marshal(messageEvent{Type: "system_message", Payload: messageResponse(message)})
+	if err != nil {
+		panic("could not marshal json")
+	}
+	emitter.Broadcast(ulid.ULID(message.GrpID), data)
+}
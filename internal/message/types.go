@@ -1,30 +1,173 @@
 package message
 
 import (
+	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/ananthvk/gochat/internal/attachment"
 	"github.com/oklog/ulid/v2"
 )
 
-// The content of a message can have atmost 4096 characters
+// The payload of a message depends on its type, see payloads.go. content and attachment_ids are a shorthand for a payload
+// with these fields, i.e. {"type": "text", "content": "Hi"} is the same as {"type": "text", "payload": {"content": "Hi"}}
 
 type MessageCreateRequest struct {
-	Type    string `json:"type" validate:"required,oneof=text"`
+	Type          string          `json:"type" validate:"required,max=32"`
+	Payload       json.RawMessage `json:"payload"`
+	Content       string          `json:"content"`
+	AttachmentIds []string        `json:"attachment_ids"`
+	ReplyToId     string          `json:"reply_to_id" validate:"omitempty,ulid"`
+	ThreadRootId  string          `json:"thread_root_id" validate:"omitempty,ulid"`
+}
+
+// payload returns the payload of the request
+func (r MessageCreateRequest) payload() ([]byte, error) {
+	if len(r.Payload) > 0 {
+		if r.Content != "" || len(r.AttachmentIds) > 0 {
+			return nil, errors.New("payload cannot be combined with content or attachment_ids")
+		}
+		return r.Payload, nil
+	}
+	return json.Marshal(struct {
+		Content       string   `json:"content,omitempty"`
+		AttachmentIds []string `json:"attachment_ids,omitempty"`
+	}{r.Content, r.AttachmentIds})
+}
+
+// MarkReadFrame is the payload of a mark_read frame, which is sent by clients over the websocket
+type MarkReadFrame struct {
+	GrpId     string `json:"group_id" validate:"required,ulid"`
+	MessageId string `json:"message_id" validate:"required,ulid"`
+}
+
+type MessageEditRequest struct {
 	Content string `json:"content" validate:"required,max=4096"`
 }
 
 type Cursor struct {
 	Before    string `json:"before"`
 	HasBefore bool   `json:"has_before"`
+	After     string `json:"after"`
+	HasAfter  bool   `json:"has_after"`
 }
 
 type MessageResponse struct {
-	Id        string    `json:"id"`
+	Id        string          `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Type      string          `json:"type"`
+	GrpId     string          `json:"group_id"`
+	Content   string          `json:"content"`
+	Payload   json.RawMessage `json:"payload"`
+	SenderId  *string         `json:"sender_id"`
+	EditedAt  *time.Time      `json:"edited_at"`
+	DeletedAt *time.Time      `json:"deleted_at"`
+	DeletedBy *string         `json:"deleted_by"`
+	ReplyToId *string         `json:"reply_to_id"`
+	// A preview of the message this message replies to, it is nil if the message is not a reply, or if the parent has been purged
+	ReplyTo *MessagePreviewResponse `json:"reply_to"`
+	// Set if the message is a reply in a thread
+	ThreadRootId *string `json:"thread_root_id"`
+	// The number of replies and the time of the last reply, if the message has started a thread
+	ReplyCount  int32      `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at"`
+	// The reactions to the message, grouped by emoji
+	Reactions []ReactionCountResponse `json:"reactions"`
+	// The users mentioned in the content, in the order in which they appear
+	Entities []MessageEntityResponse `json:"entities"`
+	// The files of file and image messages
+	Attachments []attachment.AttachmentResponse `json:"attachments"`
+	// The results of a poll, it is nil for other types of messages
+	Poll *PollResponse `json:"poll"`
+}
+
+// PollResponse is the results of a poll. Vote has the options chosen by the current user, it is null in poll_updated events
+type PollResponse struct {
+	Options     []PollOptionResponse `json:"options"`
+	TotalVoters int                  `json:"total_voters"`
+	Closed      bool                 `json:"closed"`
+	Vote        []int                `json:"vote"`
+}
+
+// PollOptionResponse is the number of votes for an option of a poll, the voters are null if the poll is anonymous
+type PollOptionResponse struct {
+	Text     string   `json:"text"`
+	Votes    int      `json:"votes"`
+	VoterIds []string `json:"voter_ids"`
+}
+
+// PollVoteRequest has the indexes of the chosen options of a poll, an empty list retracts the vote. A poll has atmost 10
+// options, so max only rejects oversized requests early, the indexes are checked against the options of the poll when voting
+type PollVoteRequest struct {
+	Options []int `json:"options" validate:"max=10,unique"`
+}
+
+// MessageEntityResponse is a span of the content of a message, such as a mention of a user. The offset and the length are in
+// unicode code points
+type MessageEntityResponse struct {
+	Type     string `json:"type"`
+	Offset   int32  `json:"offset"`
+	Length   int32  `json:"length"`
+	UserId   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// ReactionCountResponse is the number of reactions with an emoji to a message, Reacted is true if the current user is one of them
+type ReactionCountResponse struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+type ReactionResponse struct {
+	Emoji     string    `json:"emoji"`
+	UserId    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
-	Type      string    `json:"type"`
-	GrpId     string    `json:"group_id"`
-	Content   string    `json:"content"`
-	SenderId  string    `json:"sender_id"`
+}
+
+// MessagePreviewResponse is a compact view of a message, only the first 100 characters of the content are included
+type MessagePreviewResponse struct {
+	Id         string  `json:"id"`
+	SenderId   *string `json:"sender_id"`
+	SenderName string  `json:"sender_name"`
+	Content    string  `json:"content"`
+	Deleted    bool    `json:"deleted"`
+}
+
+// MessageDetailResponse is a message along with its delivery and read status for each member of the group
+type MessageDetailResponse struct {
+	MessageResponse
+	Statuses []MessageStatusResponse `json:"statuses"`
+}
+
+type MessageStatusResponse struct {
+	UserId    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type MessageRevisionResponse struct {
+	Id         string    `json:"id"`
+	Content    string    `json:"content"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// SearchResultResponse is a message that matched a search, the snippet is HTML escaped, and the matching words in it are wrapped
+// in <mark> tags
+type SearchResultResponse struct {
+	Id           string    `json:"id"`
+	GrpId        string    `json:"group_id"`
+	GroupName    string    `json:"group_name"`
+	SenderId     string    `json:"sender_id"`
+	SenderName   string    `json:"sender_name"`
+	Type         string    `json:"type"`
+	CreatedAt    time.Time `json:"created_at"`
+	Snippet      string    `json:"snippet"`
+	ThreadRootId *string   `json:"thread_root_id"`
 }
 
 type MessagePaginationResponse struct {
@@ -32,7 +175,52 @@ type MessagePaginationResponse struct {
 	Messsages MessageResponse `json:"messages"`
 }
 
-// MessageEmitter is an interface that emits notifications to connected clients of a group
+// MessageEmitter is an interface that emits notifications to connected clients of a group, or to all the connected clients of a user
 type MessageEmitter interface {
 	Broadcast(groupId ulid.ULID, message []byte)
+	SendToUser(userId ulid.ULID, message []byte)
+}
+
+type messageEvent struct {
+	Type    string `json:"type"`
+	Payload any    `json:"payload"`
+}
+
+type messageEventPayload struct {
+	Id    string `json:"id"`
+	GrpId string `json:"group_id"`
+}
+
+// threadEventPayload is the payload of a thread_message event, it also contains the updated reply count of the thread
+type threadEventPayload struct {
+	Message     MessageResponse `json:"message"`
+	ReplyCount  int32           `json:"reply_count"`
+	LastReplyAt time.Time       `json:"last_reply_at"`
+}
+
+// statusEventPayload is sent to the sender of the messages, when another member has received or read them
+type statusEventPayload struct {
+	GrpId      string   `json:"group_id"`
+	UserId     string   `json:"user_id"`
+	Status     string   `json:"status"`
+	MessageIds []string `json:"message_ids"`
+}
+
+// readMarkerEventPayload is sent to all the connections of a user when their read marker in a group moves forward
+type readMarkerEventPayload struct {
+	GrpId             string `json:"group_id"`
+	LastReadMessageId string `json:"last_read_message_id"`
+}
+
+type pollEventPayload struct {
+	MessageId string        `json:"message_id"`
+	GrpId     string        `json:"group_id"`
+	Poll      *PollResponse `json:"poll"`
+}
+
+type reactionEventPayload struct {
+	MessageId string `json:"message_id"`
+	GrpId     string `json:"group_id"`
+	UserId    string `json:"user_id"`
+	Emoji     string `json:"emoji"`
 }
@@ -1,9 +1,12 @@
 package realtime
 
 import (
+	"context"
+	"encoding/json"
 	"log/slog"
 	"time"
 
+	"github.com/ananthvk/gochat/internal/errs"
 	"github.com/gorilla/websocket"
 	"github.com/oklog/ulid/v2"
 )
@@ -26,6 +29,21 @@ const (
 	maxMessageSize = 4096
 )
 
+// frame is a message sent by a client over the websocket, it has the same shape as the events sent by the server
+type frame struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type errorFrame struct {
+	Type    string      `json:"type"`
+	Frame   string      `json:"frame"`
+	Payload *errs.Error `json:"payload"`
+}
+
+// FrameHandler handles a frame of a specific type sent by a connection of the user
+type FrameHandler func(ctx context.Context, userId ulid.ULID, payload json.RawMessage) *errs.Error
+
 type client struct {
 	ID          ulid.ULID
 	UserId      ulid.ULID
@@ -47,8 +65,8 @@ func newClient(conn *websocket.Conn, userId, clientId ulid.ULID, h *hub) *client
 }
 
 // ReaderLoop must be run in a separate goroutine. This function runs until the connection is terminated.
-// Since websockets are currently used only for notifications, the reader loop only listens for pong responses
-// to keep the connection alive
+// The reader loop listens for pong responses to keep the connection alive, and passes the frames sent by the client
+// to their registered handlers
 func (c *client) ReaderLoop() {
 	defer func() {
 		c.clientHub.control <- unregisterClientEvent{clientId: c.ID}
@@ -66,16 +84,40 @@ func (c *client) ReaderLoop() {
 	c.Connection.SetPongHandler(func(string) error { c.Connection.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
-		// Sliently drop messages
 		// TODO: Later use this for typing / online indicators
-		_, _, err := c.Connection.ReadMessage()
+		_, data, err := c.Connection.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				slog.Error("websocket read failed", "clientId", c.ID, "error", err, "connectionId", c.ID)
 			}
 			return
 		}
+		c.handleFrame(data)
+	}
+}
+
+// handleFrame passes a frame sent by the client to the handler registered for its type. Frames that cannot be parsed, or
+// which have no handler are silently dropped. If the handler fails, the error is sent back to the client as an error frame
+func (c *client) handleFrame(data []byte) {
+	f := frame{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		slog.Info("dropped invalid frame", "clientId", c.ID, "error", err)
+		return
+	}
+	handler, ok := c.clientHub.frameHandlers[f.Type]
+	if !ok {
+		slog.Info("dropped frame", "clientId", c.ID, "reason", "no handler", "type", f.Type)
+		return
+	}
+	appErr := handler(context.Background(), c.UserId, f.Payload)
+	if appErr == nil {
+		return
+	}
+	reply, err := json.Marshal(errorFrame{Type: "error", Frame: f.Type, Payload: appErr})
+	if err != nil {
+		panic("could not marshal json")
 	}
+	c.clientHub.events <- sendToClientEvent{clientId: c.ID, payload: reply}
 }
 
 // WriterLoop must be run in a separate goroutine. This function runs until the connection is terminated.
@@ -44,21 +44,21 @@ func handlerCreateWSConnection(rt *RealtimeService, w http.ResponseWriter, r *ht
 		return
 	}
 
-	clientId := rt.RegisterConnection(conn, ulid.Make())
+	clientId := rt.RegisterConnection(conn, userId)
 
 	// TOOD: Move it into a service later, for now just do the db call here to get the list of groups the user is part of
 	// TODO: Also move it into a separate notification service (which depends on db + realtime instead of making realtime depend on the db)
 	ctx, cancel := context.WithTimeout(r.Context(), rt.Db.QueryTimeout)
 	defer cancel()
 
-	grps, err := rt.Db.Queries.GetGroups(ctx, userId[:])
+	mems, err := rt.Db.Queries.GetUserMemberships(ctx, userId[:])
 	if err != nil {
 		helpers.RespondWithAppError(w, errs.Internal("internal server error while fetching groups"))
 		return
 	}
-	groupIds := make([]ulid.ULID, len(grps))
-	for i, grp := range grps {
-		groupIds[i] = ulid.ULID(grp.ID)
+	groupIds := make([]ulid.ULID, len(mems))
+	for i, mem := range mems {
+		groupIds[i] = ulid.ULID(mem.GrpID)
 	}
 	rt.AddConnectionToRooms(groupIds, clientId)
 }
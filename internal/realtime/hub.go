@@ -34,22 +34,50 @@ type createRoomsAndAddClientEvent struct {
 	roomIds  []ulid.ULID
 }
 
+type addUserToRoomEvent struct {
+	userId ulid.ULID
+	roomId ulid.ULID
+}
+
+type removeUserFromRoomEvent struct {
+	userId ulid.ULID
+	roomId ulid.ULID
+}
+
+type sendToUserEvent struct {
+	userId  ulid.ULID
+	payload []byte
+}
+
+type sendToClientEvent struct {
+	clientId ulid.ULID
+	payload  []byte
+}
+
 // hub manages a set of websocket connections
 // It handles routing of messages
 type hub struct {
 	clients map[ulid.ULID]*client
 	// rooms map room id to a set of clients
-	rooms   map[ulid.ULID]clientSet
+	rooms map[ulid.ULID]clientSet
+	// users map user id to the set of clients (connections) of the user
+	users   map[ulid.ULID]clientSet
 	events  chan event
 	control chan event
+	// frameHandlers map the type of a frame sent by a client to its handler. Handlers are registered before any client
+	// connects, and the map is only read afterwards, so it is not guarded by the event loop
+	frameHandlers map[string]FrameHandler
 }
 
 func newHub() *hub {
 	return &hub{
 		clients: make(map[ulid.ULID]*client),
 		rooms:   make(map[ulid.ULID]clientSet),
+		users:   make(map[ulid.ULID]clientSet),
 		events:  make(chan event, maxEventsHub),
 		control: make(chan event),
+
+		frameHandlers: make(map[string]FrameHandler),
 	}
 }
 
@@ -83,6 +111,10 @@ func (h *hub) processEvent(ev event) {
 	switch e := ev.(type) {
 	case broadcastEvent:
 		h.handleBroadcast(e)
+	case sendToUserEvent:
+		h.handleSendToUser(e)
+	case sendToClientEvent:
+		h.handleSendToClient(e)
 	default:
 		slog.Error("internal error", "reason", "unknown event")
 		panic("unknown event")
@@ -116,6 +148,34 @@ func (h *hub) handleBroadcast(e broadcastEvent) {
 	}
 }
 
+// handleSendToUser sends the payload to all connected clients of a user. Similar to broadcast, if the outgoing channel
+// of a client is full, the message is dropped silently
+func (h *hub) handleSendToUser(e sendToUserEvent) {
+	for clientId := range h.users[e.userId] {
+		client := h.clients[clientId]
+		if client == nil {
+			continue
+		}
+		select {
+		case client.Outgoing <- e.payload:
+		default:
+		}
+	}
+}
+
+// handleSendToClient sends the payload to a single connection, it is used to reply to a frame sent by the client. Since the
+// outgoing channel is closed by the hub, clients must not write to it directly
+func (h *hub) handleSendToClient(e sendToClientEvent) {
+	client := h.clients[e.clientId]
+	if client == nil {
+		return
+	}
+	select {
+	case client.Outgoing <- e.payload:
+	default:
+	}
+}
+
 // processControlEvent handles control events for the hub, processing connection
 // registration and unregistration events. It routes the event to the appropriate
 // handler based on the event type. If an unknown event type is received, it logs
@@ -128,6 +188,10 @@ func (h *hub) processControlEvent(event event) {
 		h.processUnregisterEvent(e)
 	case createRoomsAndAddClientEvent:
 		h.processCreateRoomAndJoinEvent(e)
+	case addUserToRoomEvent:
+		h.processAddUserToRoomEvent(e)
+	case removeUserFromRoomEvent:
+		h.processRemoveUserFromRoomEvent(e)
 	default:
 		slog.Error("internal error", "reason", "unknown control event")
 		panic("unknown control event")
@@ -139,6 +203,12 @@ func (h *hub) processControlEvent(event event) {
 func (h *hub) processRegisterEvent(e registerClientEvent) {
 	client := newClient(e.conn, e.userId, e.clientId, h)
 	h.clients[client.ID] = client
+	userClients, ok := h.users[client.UserId]
+	if !ok {
+		userClients = make(clientSet)
+		h.users[client.UserId] = userClients
+	}
+	userClients[client.ID] = struct{}{}
 	go client.ReaderLoop()
 	go client.WriterLoop()
 	slog.Info("processed register event", "clientId", client.ID)
@@ -151,6 +221,12 @@ func (h *hub) processUnregisterEvent(e unregisterClientEvent) {
 	if client, ok := h.clients[e.clientId]; ok {
 		delete(h.clients, e.clientId)
 		close(client.Outgoing)
+		if userClients, ok := h.users[client.UserId]; ok {
+			delete(userClients, e.clientId)
+			if len(userClients) == 0 {
+				delete(h.users, client.UserId)
+			}
+		}
 		// Note: We are not removing the client from all the maps, since they get lazily deleted when a broadcast message is sent
 		// Note: This might be an issue if say a rogue client repeatedly connects / disconnects causing the map to get full (when no messages are sent)
 		slog.Info("processed unregister event", "clientId", e.clientId)
@@ -171,3 +247,34 @@ func (h *hub) processCreateRoomAndJoinEvent(e createRoomsAndAddClientEvent) {
 	}
 	slog.Info("processed createRoomsAndAddClientEvent", "client", e.clientId)
 }
+
+// processAddUserToRoomEvent adds all connected clients of the user to the room. It is used when a user joins a group,
+// so that they need not reconnect to receive messages sent to the group
+func (h *hub) processAddUserToRoomEvent(e addUserToRoomEvent) {
+	userClients, ok := h.users[e.userId]
+	if !ok {
+		return
+	}
+	room, ok := h.rooms[e.roomId]
+	if !ok {
+		room = make(clientSet)
+		h.rooms[e.roomId] = room
+	}
+	for clientId := range userClients {
+		room[clientId] = struct{}{}
+	}
+	slog.Info("processed addUserToRoomEvent", "user", e.userId, "room", e.roomId)
+}
+
+// processRemoveUserFromRoomEvent removes all connected clients of the user from the room. It is used when a user leaves
+// or is removed from a group, the clients stop receiving broadcasts immediately
+func (h *hub) processRemoveUserFromRoomEvent(e removeUserFromRoomEvent) {
+	room, ok := h.rooms[e.roomId]
+	if !ok {
+		return
+	}
+	for clientId := range h.users[e.userId] {
+		delete(room, clientId)
+	}
+	slog.Info("processed removeUserFromRoomEvent", "user", e.userId, "room", e.roomId)
+}
@@ -38,13 +38,29 @@ func (r *RealtimeService) AddConnectionToRooms(roomIds []ulid.ULID, clientId uli
 	r.clientHub.control <- createRoomsAndAddClientEvent{clientId: clientId, roomIds: roomIds}
 }
 
-func (r *RealtimeService) RemoveConnectionFromRoom(connectionId ulid.ULID, roomId ulid.ULID) {
-	// TOOD: Implement this
-	// Only needed when a user is removed from a group
+// AddUserToRoom adds all the connections of the user to the room, used when a user joins a group
+func (r *RealtimeService) AddUserToRoom(roomId ulid.ULID, userId ulid.ULID) {
+	r.clientHub.control <- addUserToRoomEvent{userId: userId, roomId: roomId}
+}
+
+// RemoveUserFromRoom removes all the connections of the user from the room, used when a user leaves or is removed from a group
+func (r *RealtimeService) RemoveUserFromRoom(roomId ulid.ULID, userId ulid.ULID) {
+	r.clientHub.control <- removeUserFromRoomEvent{userId: userId, roomId: roomId}
 }
 
 func (r *RealtimeService) Broadcast(roomId ulid.ULID, message []byte) {
 	r.clientHub.events <- broadcastEvent{targetRoom: roomId, payload: message}
 }
 
+// SendToUser sends the message to all the connections of the user
+func (r *RealtimeService) SendToUser(userId ulid.ULID, message []byte) {
+	r.clientHub.events <- sendToUserEvent{userId: userId, payload: message}
+}
+
+// HandleFrame registers the handler for frames of the given type sent by clients, it must be called before the server starts
+// accepting connections
+func (r *RealtimeService) HandleFrame(frameType string, handler FrameHandler) {
+	r.clientHub.frameHandlers[frameType] = handler
+}
+
 // Other methods that are necesssary - A method to remove all connections associated with a client (incase of logout)
@@ -6,6 +6,8 @@ import (
 	"github.com/ananthvk/gochat/internal/app"
 	"github.com/ananthvk/gochat/internal/auth"
 	"github.com/ananthvk/gochat/internal/group"
+	"github.com/ananthvk/gochat/internal/invite"
+	"github.com/ananthvk/gochat/internal/message"
 	"github.com/ananthvk/gochat/internal/middleware"
 
 	"github.com/ananthvk/gochat/internal/health"
@@ -17,7 +19,11 @@ func Routes(app *app.App, middlewares middleware.Middlewares) chi.Router {
 	router := chi.NewRouter()
 	router.Mount("/realtime", realtime.Routes(app.RealtimeService, middlewares))
 	router.Mount("/auth", auth.Routes(app.AuthService, middlewares))
-	router.Mount("/group", group.Routes(app.GroupService, app.MessageService, middlewares))
+	router.Mount("/group", group.Routes(app.GroupService, app.MessageService, app.InviteService, app.AttachmentService, middlewares))
+	router.Mount("/invite", invite.RedeemRoutes(app.InviteService, middlewares))
+	router.Mount("/dm", group.DirectRoutes(app.GroupService, middlewares))
+	router.Mount("/search", message.SearchRoutes(app.MessageService, middlewares))
+	router.Mount("/me/mentions", message.MentionRoutes(app.MessageService, middlewares))
 	router.Get("/health", func(w http.ResponseWriter, r *http.Request) { health.HealthCheckHandler(app, w, r) })
 	return router
 }
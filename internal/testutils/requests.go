@@ -3,12 +3,15 @@ package testutils
 import (
 	"bytes"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ananthvk/gochat/internal/helpers"
+	"github.com/oklog/ulid/v2"
 )
 
 func CheckStatusCode(t *testing.T, r *http.Response, s int) {
@@ -116,11 +119,12 @@ type AuthenticatedRequest struct {
 // authenticated requests can be made
 func (a *AuthenticatedRequest) GetAuth(t *testing.T, server *httptest.Server) {
 	t.Helper()
-	currentTime := time.Now().Format("20060102150405")
+	// A random suffix is added so that multiple users can be created in the same second
+	suffix := time.Now().Format("20060102150405") + strings.ToLower(ulid.Make().String()[20:])
 	resp := MakePostRequest(t, server, "/api/v1/auth/signup", map[string]any{
 		"name":     "A Test User",
-		"email":    "test" + currentTime + "@example.com",
-		"username": "test_user" + currentTime,
+		"email":    "test" + suffix + "@example.com",
+		"username": "test_user" + suffix,
 		"password": "testuser123",
 	})
 	if resp.StatusCode != http.StatusCreated {
@@ -243,3 +247,62 @@ func (a *AuthenticatedRequest) MakeAuthenticatedPatchRequest(t *testing.T, serve
 
 	return resp
 }
+
+// MakeAuthenticatedPutRequest creates a PUT request with JSON body and Authorization header
+func (a *AuthenticatedRequest) MakeAuthenticatedPutRequest(t *testing.T, server *httptest.Server, path string, body any) *http.Response {
+	t.Helper()
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	reqBody := bytes.NewReader(jsonData)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+path, reqBody)
+	if err != nil {
+		t.Fatalf("Failed to create PUT request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make authenticated PUT request: %v", err)
+	}
+
+	return resp
+}
+
+// MakeAuthenticatedUploadRequest creates a POST request with a multipart form containing the file in the given field, along
+// with the Authorization header
+func (a *AuthenticatedRequest) MakeAuthenticatedUploadRequest(t *testing.T, server *httptest.Server, path string, field string, filename string, contents []byte) *http.Response {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatalf("Failed to create multipart form: %v", err)
+	}
+	part.Write(contents)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to create multipart form: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, body)
+	if err != nil {
+		t.Fatalf("Failed to create POST request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make authenticated upload request: %v", err)
+	}
+
+	return resp
+}
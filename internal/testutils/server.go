@@ -10,10 +10,12 @@ import (
 
 	"github.com/ananthvk/gochat/internal"
 	"github.com/ananthvk/gochat/internal/app"
+	"github.com/ananthvk/gochat/internal/attachment"
 	"github.com/ananthvk/gochat/internal/auth"
 	"github.com/ananthvk/gochat/internal/config"
 	"github.com/ananthvk/gochat/internal/database"
 	"github.com/ananthvk/gochat/internal/group"
+	"github.com/ananthvk/gochat/internal/invite"
 	"github.com/ananthvk/gochat/internal/message"
 	"github.com/ananthvk/gochat/internal/middleware"
 	"github.com/ananthvk/gochat/internal/realtime"
@@ -75,6 +77,9 @@ func newTestServerWithDatabase(t *testing.T, ctx context.Context) (*app.App, *ch
 		DbDSN:                     testDB.ConnStr,
 		DbPingTimeout:             5 * time.Second,
 		DbQueryTimeout:            5 * time.Second,
+		MessageEditWindow:         15 * time.Minute,
+		AttachmentMaxSize:         1 << 20,
+		AttachmentAllowedTypes:    []string{"image/png", "text/plain"},
 	}
 
 	dbService, err := database.NewDatabaseService(ctx, cfg)
@@ -82,8 +87,15 @@ func newTestServerWithDatabase(t *testing.T, ctx context.Context) (*app.App, *ch
 	if err != nil {
 		log.Fatalf("could not create database service %s", err)
 	}
-	groupService := group.NewGroupService(dbService)
-	mesageService := message.NewMessageService(dbService, rtService)
+	groupService := group.NewGroupService(dbService, rtService)
+	mesageService := message.NewMessageService(dbService, rtService, cfg.MessageEditWindow)
+	rtService.HandleFrame("mark_read", mesageService.HandleMarkReadFrame)
+	inviteService := invite.NewInviteService(dbService, groupService)
+	blobStore, err := attachment.NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		log.Fatalf("could not create blob store %s", err)
+	}
+	attachmentService := attachment.NewAttachmentService(dbService, blobStore, cfg.AttachmentMaxSize, cfg.AttachmentAllowedTypes)
 	tokenService := token.NewTokenService(dbService)
 	authService := auth.NewAuthService(dbService, tokenService)
 
@@ -95,14 +107,16 @@ func newTestServerWithDatabase(t *testing.T, ctx context.Context) (*app.App, *ch
 	}
 
 	app := &app.App{
-		Ctx:             ctx,
-		RealtimeService: rtService,
-		DatabaseService: dbService,
-		GroupService:    groupService,
-		MessageService:  mesageService,
-		AuthService:     authService,
-		TokenService:    tokenService,
-		Config:          cfg,
+		Ctx:               ctx,
+		RealtimeService:   rtService,
+		DatabaseService:   dbService,
+		GroupService:      groupService,
+		InviteService:     inviteService,
+		MessageService:    mesageService,
+		AttachmentService: attachmentService,
+		AuthService:       authService,
+		TokenService:      tokenService,
+		Config:            cfg,
 	}
 	middlewares := middleware.Middlewares{
 		Authenticate: auth.AuthMiddleware(tokenService),
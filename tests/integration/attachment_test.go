@@ -0,0 +1,246 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ananthvk/gochat/internal/attachment"
+	"github.com/ananthvk/gochat/internal/testutils"
+)
+
+// A minimal PNG image (1x1 pixel), the content type of attachments is detected from the contents
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestAttachment(t *testing.T) {
+	app, srv, _, cancel := testutils.NewTestServerWithDatabaseAndCancel(t)
+	defer srv.Close()
+	defer cancel()
+
+	req := testutils.AuthenticatedRequest{}
+	req.GetAuth(t, srv)
+	member := testutils.AuthenticatedRequest{}
+	member.GetAuth(t, srv)
+	outsider := testutils.AuthenticatedRequest{}
+	outsider.GetAuth(t, srv)
+
+	resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{"name": "Attachment Test Group"})
+	testutils.CheckStatusCode(t, resp, http.StatusCreated)
+	grpData := map[string]any{}
+	testutils.UnmarshalJSONResponse(t, resp, &grpData)
+	groupId := grpData["id"].(string)
+	resp = member.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+	testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+	attachmentsUrl := "/api/v1/group/" + groupId + "/attachment"
+	upload := func(u testutils.AuthenticatedRequest, filename string, contents []byte) map[string]any {
+		resp := u.MakeAuthenticatedUploadRequest(t, srv, attachmentsUrl, "file", filename, contents)
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		data := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &data)
+		return data
+	}
+
+	t.Run("TestAttachmentUpload", func(t *testing.T) {
+		data := upload(req, "../../pixel.png", pngImage)
+		if data["content_type"] != "image/png" || data["filename"] != "pixel.png" || data["size"] != float64(len(pngImage)) {
+			t.Errorf("unexpected attachment %v", data)
+		}
+		if data["message_id"] != nil {
+			t.Errorf("expected the attachment to not be sent, got %v", data["message_id"])
+		}
+
+		// Types which are not allowed are rejected, even if the filename looks fine
+		resp := req.MakeAuthenticatedUploadRequest(t, srv, attachmentsUrl, "file", "image.png", []byte("%PDF-1.4 not an image"))
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedUploadRequest(t, srv, attachmentsUrl, "file", "large.txt", bytes.Repeat([]byte("a"), 1<<20+1))
+		testutils.CheckStatusCode(t, resp, http.StatusRequestEntityTooLarge)
+		resp = outsider.MakeAuthenticatedUploadRequest(t, srv, attachmentsUrl, "file", "notes.txt", []byte("hello"))
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, attachmentsUrl, map[string]any{"file": "notes.txt"})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("TestAttachmentMessage", func(t *testing.T) {
+		image := upload(req, "pixel.png", pngImage)["id"].(string)
+		notes := upload(req, "notes.txt", []byte("meeting notes"))["id"].(string)
+		messagesUrl := "/api/v1/group/" + groupId + "/message"
+
+		// Attachments which have not been sent can only be downloaded by the uploader
+		resp := member.MakeAuthenticatedGetRequest(t, srv, attachmentsUrl+"/"+image)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "image", "attachment_ids": []string{notes}})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "image"})
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "text", "content": "Hi", "attachment_ids": []string{notes}})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		// Only the uploader can send an attachment
+		resp = member.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "file", "attachment_ids": []string{notes}})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{
+			"type":           "image",
+			"content":        "Look at this",
+			"attachment_ids": []string{image},
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		msgData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		attachments := msgData["attachments"].([]any)
+		if len(attachments) != 1 || attachments[0].(map[string]any)["id"] != image {
+			t.Fatalf("expected the image in the attachments, got %v", attachments)
+		}
+		messageId := msgData["id"].(string)
+
+		// An attachment can only be sent once
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "file", "attachment_ids": []string{image}})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		resp = member.MakeAuthenticatedGetRequest(t, srv, attachmentsUrl+"/"+image)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		if resp.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("expected image/png, got %q", resp.Header.Get("Content-Type"))
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Disposition"), "inline") {
+			t.Errorf("expected the image to be inline, got %q", resp.Header.Get("Content-Disposition"))
+		}
+		contents, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !bytes.Equal(contents, pngImage) {
+			t.Errorf("downloaded attachment does not match the uploaded file")
+		}
+		resp = outsider.MakeAuthenticatedGetRequest(t, srv, attachmentsUrl+"/"+image)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The attachments of deleted messages can no longer be downloaded
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, messagesUrl+"/"+messageId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = member.MakeAuthenticatedGetRequest(t, srv, attachmentsUrl+"/"+image)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("TestAttachmentSweep", func(t *testing.T) {
+		ctx := context.Background()
+		queued := func() int {
+			var count int
+			err := app.DatabaseService.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM blob_deletion").Scan(&count)
+			if err != nil {
+				t.Fatalf("could not count queued blobs: %v", err)
+			}
+			return count
+		}
+
+		// The blobs of purged messages are queued by the trigger, and deleted by the sweeper
+		image := upload(req, "pixel.png", pngImage)["id"].(string)
+		messagesUrl := "/api/v1/group/" + groupId + "/message"
+		resp := req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "image", "attachment_ids": []string{image}})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		msgData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, messagesUrl+"/"+msgData["id"].(string)+"/purge")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		if queued() == 0 {
+			t.Errorf("expected the blob of the purged message to be queued")
+		}
+		app.AttachmentService.Sweep(ctx, time.Hour)
+		if count := queued(); count != 0 {
+			t.Errorf("expected the queued blobs to be deleted, %d are left", count)
+		}
+
+		// Attachments which are never sent expire
+		notes := upload(req, "notes.txt", []byte("draft notes"))["id"].(string)
+		app.AttachmentService.Sweep(ctx, time.Hour)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, attachmentsUrl+"/"+notes)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		app.AttachmentService.Sweep(ctx, 0)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, attachmentsUrl+"/"+notes)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+		if count := queued(); count != 0 {
+			t.Errorf("expected the blobs of expired attachments to be deleted, %d are left", count)
+		}
+	})
+}
+
+// fakeS3 is a stand-in for an S3 compatible storage, which stores the objects in memory. It only accepts requests that are
+// signed with AWS signature version 4
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access-key/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	ctx := context.Background()
+
+	store, err := attachment.NewS3BlobStore(srv.URL, "us-east-1", "gochat", "access-key", "secret-key")
+	if err != nil {
+		t.Fatalf("could not create s3 blob store: %v", err)
+	}
+	err = store.Put(ctx, "group/object", bytes.NewReader(pngImage), int64(len(pngImage)), "image/png")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, ok := fake.objects["/gochat/group/object"]; !ok {
+		t.Errorf("expected the object to be stored in the bucket, got %v", fake.objects)
+	}
+
+	contents, err := store.Get(ctx, "group/object")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	data, _ := io.ReadAll(contents)
+	contents.Close()
+	if !bytes.Equal(data, pngImage) {
+		t.Errorf("expected the stored object, got %q", data)
+	}
+
+	if err := store.Delete(ctx, "group/object"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := store.Get(ctx, "group/object"); !errors.Is(err, attachment.ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound, got %v", err)
+	}
+
+	unauthorized, _ := attachment.NewS3BlobStore(srv.URL, "eu-west-1", "gochat", "access-key", "secret-key")
+	if _, err := unauthorized.Get(ctx, "group/object"); err == nil || errors.Is(err, attachment.ErrBlobNotFound) {
+		t.Errorf("expected the request to be rejected, got %v", err)
+	}
+}
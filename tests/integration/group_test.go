@@ -2,10 +2,16 @@ package integration
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ananthvk/gochat/internal/membership"
 	"github.com/ananthvk/gochat/internal/testutils"
+	"github.com/gorilla/websocket"
 	"github.com/oklog/ulid/v2"
 )
 
@@ -134,4 +140,742 @@ func TestGroup(t *testing.T) {
 			t.Errorf("expected at least 3 groups, got %d", len(groups))
 		}
 	})
+
+	t.Run("TestGroupRoles", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Roles Test Group",
+			"description": "Group for testing roles",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		other := testutils.AuthenticatedRequest{}
+		other.GetAuth(t, srv)
+		resp := other.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// A member can neither rename, nor delete the group, nor change roles
+		resp = other.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId, map[string]any{"name": "Renamed"})
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = other.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = other.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+other.UserId, map[string]any{"role": "admin"})
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The owner promotes the member to an admin, who can then rename, but not delete the group
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+other.UserId, map[string]any{"role": "admin"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = other.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId, map[string]any{"name": "Renamed"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = other.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The role of the owner cannot be changed
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+req.UserId, map[string]any{"role": "member"})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("TestGroupLeaveAndRemoveMember", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Leave Test Group",
+			"description": "Group for testing leaving and removal of members",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		first := testutils.AuthenticatedRequest{}
+		first.GetAuth(t, srv)
+		second := testutils.AuthenticatedRequest{}
+		second.GetAuth(t, srv)
+		for _, u := range []testutils.AuthenticatedRequest{first, second} {
+			resp := u.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+		}
+
+		// A member cannot remove another member
+		resp := first.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+second.UserId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The first member leaves the group, and can no longer view it
+		resp = first.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = first.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The owner removes the second member, leaving and removal respond in the same way
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+second.UserId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		removeData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &removeData)
+		if removeData["status"] != true {
+			t.Errorf("unexpected response %v", removeData)
+		}
+		resp = second.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message")
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The owner cannot leave the group
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member")
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("TestGroupRemovedMemberBroadcasts", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{"name": "Kick Broadcast Test Group"})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		resp := member.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/realtime/ws?token="+member.Token, nil)
+		if err != nil {
+			t.Fatalf("could not connect to the websocket: %v", err)
+		}
+		defer conn.Close()
+		events := make(chan map[string]any, 16)
+		go func() {
+			defer close(events)
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				event := map[string]any{}
+				if json.Unmarshal(data, &event) == nil {
+					events <- event
+				}
+			}
+		}()
+		// receivedMessage waits for a message of the group with the content to be broadcast to the member
+		receivedMessage := func(content string, timeout time.Duration) bool {
+			deadline := time.After(timeout)
+			for {
+				select {
+				case event, ok := <-events:
+					if !ok {
+						return false
+					}
+					payload, _ := event["payload"].(map[string]any)
+					if event["type"] == "text_message" && payload["group_id"] == groupId && payload["content"] == content {
+						return true
+					}
+				case <-deadline:
+					return false
+				}
+			}
+		}
+		send := func(content string) {
+			resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{"content": content, "type": "text"})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		}
+
+		// The connection joins the rooms of its groups after the upgrade, so messages are sent until one arrives
+		subscribed := false
+		for i := 0; i < 20 && !subscribed; i++ {
+			content := "Before the kick " + strconv.Itoa(i)
+			send(content)
+			subscribed = receivedMessage(content, 250*time.Millisecond)
+		}
+		if !subscribed {
+			t.Fatalf("expected the member to receive the messages of the group")
+		}
+
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+member.UserId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		send("After the kick")
+		if receivedMessage("After the kick", time.Second) {
+			t.Errorf("expected no broadcasts to reach the member after the kick")
+		}
+	})
+
+	t.Run("TestDirectConversation", func(t *testing.T) {
+		peer := testutils.AuthenticatedRequest{}
+		peer.GetAuth(t, srv)
+
+		resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/dm/"+peer.UserId, nil)
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &createData)
+		groupId := createData["id"].(string)
+
+		// The same conversation is returned irrespective of who starts it
+		resp = peer.MakeAuthenticatedPostRequest(t, srv, "/api/v1/dm/"+req.UserId, nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		existingData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &existingData)
+		if existingData["id"] != groupId {
+			t.Errorf("expected id %q, got %q", groupId, existingData["id"])
+		}
+
+		// Direct conversations cannot be renamed, deleted, joined or invited to
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId, map[string]any{"name": "Renamed"})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		other := testutils.AuthenticatedRequest{}
+		other.GetAuth(t, srv)
+		resp = other.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		// The sidebar shows the name of the other participant
+		resp = peer.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		listData := struct {
+			Groups []struct {
+				Id   string `json:"id"`
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+				Peer *struct {
+					Id string `json:"id"`
+				} `json:"peer"`
+			} `json:"groups"`
+		}{}
+		testutils.UnmarshalJSONResponse(t, resp, &listData)
+		if len(listData.Groups) != 1 || listData.Groups[0].Kind != "direct" || listData.Groups[0].Peer == nil {
+			t.Fatalf("expected exactly one direct conversation, got %+v", listData.Groups)
+		}
+		if listData.Groups[0].Peer.Id != req.UserId {
+			t.Errorf("expected peer %q, got %q", req.UserId, listData.Groups[0].Peer.Id)
+		}
+	})
+
+	t.Run("TestGroupVisibility", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Private Test Group",
+			"description": "Group that can only be joined through an invite",
+			"visibility":  "private",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		privateId := createData["id"].(string)
+
+		createResp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Public Directory Group",
+			"description": "Group that is listed in the directory",
+			"visibility":  "public",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		publicId := createData["id"].(string)
+
+		user := testutils.AuthenticatedRequest{}
+		user.GetAuth(t, srv)
+		resp := user.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+privateId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/directory?q=directory")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		directory := struct {
+			Groups []struct {
+				Id          string `json:"id"`
+				MemberCount int64  `json:"member_count"`
+			} `json:"groups"`
+		}{}
+		testutils.UnmarshalJSONResponse(t, resp, &directory)
+		if len(directory.Groups) != 1 || directory.Groups[0].Id != publicId {
+			t.Fatalf("expected only the public group in the directory, got %+v", directory.Groups)
+		}
+		if directory.Groups[0].MemberCount != 1 {
+			t.Errorf("expected member count 1, got %d", directory.Groups[0].MemberCount)
+		}
+
+		resp = user.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+publicId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+	})
+
+	t.Run("TestGroupJoinRequest", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Join Request Test Group",
+			"description": "Group for testing join requests",
+			"visibility":  "private",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		approved := testutils.AuthenticatedRequest{}
+		approved.GetAuth(t, srv)
+		rejected := testutils.AuthenticatedRequest{}
+		rejected.GetAuth(t, srv)
+		for _, u := range []testutils.AuthenticatedRequest{approved, rejected} {
+			resp := u.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/join-request", map[string]any{"message": "Please let me in"})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		}
+
+		// Only the owner and admins can view the pending requests
+		resp := approved.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/join-request")
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/join-request")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		listData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &listData)
+		if reqs, ok := listData["join_requests"].([]any); !ok || len(reqs) != 2 {
+			t.Fatalf("expected 2 pending join requests, got %v", listData["join_requests"])
+		}
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/join-request/"+approved.UserId+"/approve", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/join-request/"+rejected.UserId+"/reject", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		resp = approved.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = rejected.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// A decided request cannot be decided again
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/join-request/"+rejected.UserId+"/approve", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+
+		// A request is still resolved when the requester has joined through an invite in the meantime
+		invited := testutils.AuthenticatedRequest{}
+		invited.GetAuth(t, srv)
+		resp = invited.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/join-request", map[string]any{"message": "Please let me in"})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/invite", map[string]any{"max_uses": 1})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		invite := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &invite)
+		resp = invited.MakeAuthenticatedPostRequest(t, srv, "/api/v1/invite/"+invite["code"].(string), nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/join-request/"+invited.UserId+"/approve", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/join-request")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		listData = map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &listData)
+		if reqs, ok := listData["join_requests"].([]any); !ok || len(reqs) != 0 {
+			t.Errorf("expected no pending join requests, got %v", listData["join_requests"])
+		}
+	})
+
+	t.Run("TestGroupBan", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Ban Test Group",
+			"description": "Group for testing bans",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		user := testutils.AuthenticatedRequest{}
+		user.GetAuth(t, srv)
+		resp := user.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// Members cannot ban other users
+		resp = user.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/ban/"+req.UserId, map[string]any{})
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		resp = req.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/ban/"+user.UserId, map[string]any{"reason": "spam"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// The banned user is removed, and cannot rejoin directly or through an invite
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = user.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/invite", map[string]any{"max_uses": 1})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		invite := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &invite)
+		resp = user.MakeAuthenticatedPostRequest(t, srv, "/api/v1/invite/"+invite["code"].(string), nil)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/ban")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		banData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &banData)
+		bans, ok := banData["bans"].([]any)
+		if !ok || len(bans) != 1 {
+			t.Fatalf("expected 1 ban, got %v", banData["bans"])
+		}
+		if reason := bans[0].(map[string]any)["reason"]; reason != "spam" {
+			t.Errorf("expected reason %q, got %v", "spam", reason)
+		}
+
+		// After the ban is lifted, the user can use the invite that was not used up by the failed attempt
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/ban/"+user.UserId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = user.MakeAuthenticatedPostRequest(t, srv, "/api/v1/invite/"+invite["code"].(string), nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/ban/"+user.UserId)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("TestGroupConcurrentBanAndJoin", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Concurrent Ban Group",
+			"description": "Group for testing bans that race with joins",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := ulid.MustParse(createData["id"].(string))
+
+		// Whichever of the join and the ban is committed first, the banned user must not end up as a member
+		for i := 0; i < 10; i++ {
+			user := testutils.AuthenticatedRequest{}
+			user.GetAuth(t, srv)
+			userId := ulid.MustParse(user.UserId)
+
+			done := make(chan struct{})
+			go func() {
+				app.GroupService.AddMemberToGroup(context.Background(), groupId, userId, membership.JoinDirect)
+				close(done)
+			}()
+			_, appErr := app.GroupService.Ban(context.Background(), groupId, userId, ulid.MustParse(req.UserId), "spam", nil)
+			if appErr != nil {
+				t.Fatalf("could not ban user: %v", appErr)
+			}
+			<-done
+
+			var isMember bool
+			err := app.DatabaseService.Pool.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM grp_membership WHERE grp_id = $1 AND usr_id = $2)", groupId.Bytes(), userId.Bytes()).Scan(&isMember)
+			if err != nil {
+				t.Fatalf("could not check membership: %v", err)
+			}
+			if isMember {
+				t.Fatalf("expected the banned user not to be a member of the group")
+			}
+		}
+	})
+
+	t.Run("TestGroupOwnershipTransfer", func(t *testing.T) {
+		owner := testutils.AuthenticatedRequest{}
+		owner.GetAuth(t, srv)
+		createResp := owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Ownership Test Group",
+			"description": "Group for testing ownership transfer",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		admin := testutils.AuthenticatedRequest{}
+		admin.GetAuth(t, srv)
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		for _, u := range []testutils.AuthenticatedRequest{member, admin} {
+			resp := u.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+		}
+
+		// Only the owner can transfer ownership, and only to a member
+		resp := member.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/transfer", map[string]any{"user_id": member.UserId})
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/transfer", map[string]any{"user_id": req.UserId})
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+
+		resp = owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/transfer", map[string]any{"user_id": admin.UserId})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		dbGrp, _ := app.GroupService.GetOne(context.Background(), ulid.MustParse(groupId), ulid.MustParse(admin.UserId))
+		if dbGrp == nil || ulid.ULID(dbGrp.OwnerID).String() != admin.UserId {
+			t.Fatalf("expected owner to be %q", admin.UserId)
+		}
+		// The previous owner is now an admin, and can no longer delete the group
+		resp = owner.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// Direct conversations are not passed on to the other member, they are deleted along with the account
+		resp = admin.MakeAuthenticatedPostRequest(t, srv, "/api/v1/dm/"+member.UserId, nil)
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		dmData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &dmData)
+		dmId := dmData["id"].(string)
+
+		// Deleting the account of the owner passes the ownership to the longest standing admin, instead of deleting the group
+		_, err := app.DatabaseService.Pool.Exec(context.Background(), "DELETE FROM usr WHERE id = $1", ulid.MustParse(admin.UserId).Bytes())
+		if err != nil {
+			t.Fatalf("could not delete user: %v", err)
+		}
+		dbGrp, appErr := app.GroupService.GetOne(context.Background(), ulid.MustParse(groupId), ulid.MustParse(owner.UserId))
+		if appErr != nil {
+			t.Fatalf("expected group to survive deletion of the owner, got %v", appErr)
+		}
+		if ulid.ULID(dbGrp.OwnerID).String() != owner.UserId {
+			t.Errorf("expected ownership to pass to the admin %q, got %q", owner.UserId, ulid.ULID(dbGrp.OwnerID).String())
+		}
+		resp = owner.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		resp = member.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+dmId)
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("TestGroupConcurrentOwnershipTransfer", func(t *testing.T) {
+		owner := testutils.AuthenticatedRequest{}
+		owner.GetAuth(t, srv)
+		createResp := owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Concurrent Transfer Group",
+			"description": "Group for testing concurrent ownership transfers",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		candidates := make([]testutils.AuthenticatedRequest, 2)
+		for i := range candidates {
+			candidates[i].GetAuth(t, srv)
+			resp := candidates[i].MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+		}
+
+		// Only one of the transfers can succeed, the other one finds that the user is no longer the owner
+		statuses := make(chan int, len(candidates))
+		for _, candidate := range candidates {
+			go func() {
+				appErr := app.GroupService.TransferOwnership(context.Background(), ulid.MustParse(groupId), ulid.MustParse(candidate.UserId), ulid.MustParse(owner.UserId))
+				if appErr != nil {
+					statuses <- appErr.Status
+					return
+				}
+				statuses <- http.StatusOK
+			}()
+		}
+		succeeded := 0
+		for range candidates {
+			status := <-statuses
+			if status == http.StatusOK {
+				succeeded++
+			} else if status != http.StatusForbidden {
+				t.Errorf("expected status %d, got %d", http.StatusForbidden, status)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("expected exactly one transfer to succeed, got %d", succeeded)
+		}
+
+		var owners int
+		err := app.DatabaseService.Pool.QueryRow(context.Background(), "SELECT count(*) FROM grp_membership WHERE grp_id = $1 AND role = 'owner'", ulid.MustParse(groupId).Bytes()).Scan(&owners)
+		if err != nil {
+			t.Fatalf("could not count owners: %v", err)
+		}
+		if owners != 1 {
+			t.Errorf("expected exactly one owner, got %d", owners)
+		}
+
+		// Transferring to a user who is not a member is rejected inside the transaction
+		dbGrp, _ := app.GroupService.GetOne(context.Background(), ulid.MustParse(groupId), ulid.MustParse(owner.UserId))
+		currentOwner := testutils.AuthenticatedRequest{}
+		for _, candidate := range candidates {
+			if ulid.ULID(dbGrp.OwnerID).String() == candidate.UserId {
+				currentOwner = candidate
+			}
+		}
+		resp := currentOwner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/transfer", map[string]any{"user_id": req.UserId})
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("TestGroupPagination", func(t *testing.T) {
+		user := testutils.AuthenticatedRequest{}
+		user.GetAuth(t, srv)
+		groupIds := []string{}
+		for i := 0; i < 3; i++ {
+			createResp := user.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+				"name":        "Pagination Test Group " + string(rune(i+'1')),
+				"description": "Group for testing pagination",
+			})
+			testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+			createData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, createResp, &createData)
+			groupIds = append(groupIds, createData["id"].(string))
+		}
+
+		// Groups without messages are ordered by their creation, newest first
+		seen := []string{}
+		before := ""
+		for {
+			resp := user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group?limit=2&before="+before)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			respData := struct {
+				Groups []struct {
+					Id string `json:"id"`
+				} `json:"groups"`
+				Cursor struct {
+					Before    string `json:"before"`
+					HasBefore bool   `json:"has_before"`
+				} `json:"cursor"`
+			}{}
+			testutils.UnmarshalJSONResponse(t, resp, &respData)
+			for _, grp := range respData.Groups {
+				seen = append(seen, grp.Id)
+			}
+			if !respData.Cursor.HasBefore {
+				break
+			}
+			before = respData.Cursor.Before
+		}
+		expected := []string{groupIds[2], groupIds[1], groupIds[0]}
+		if len(seen) != len(expected) {
+			t.Fatalf("expected groups %v, got %v", expected, seen)
+		}
+		for i := range expected {
+			if seen[i] != expected[i] {
+				t.Fatalf("expected groups %v, got %v", expected, seen)
+			}
+		}
+
+		resp := user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group?limit=0")
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+
+		// The cursor is the last activity, so a group below the cursor which gets a new message moves above it, and is only seen
+		// when the list is fetched again from the top (clients merge the realtime events instead)
+		type groupPage struct {
+			Groups []struct {
+				Id string `json:"id"`
+			} `json:"groups"`
+			Cursor struct {
+				Before    string `json:"before"`
+				HasBefore bool   `json:"has_before"`
+			} `json:"cursor"`
+		}
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group?limit=2")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		firstPage := groupPage{}
+		testutils.UnmarshalJSONResponse(t, resp, &firstPage)
+		if len(firstPage.Groups) != 2 || !firstPage.Cursor.HasBefore {
+			t.Fatalf("expected a full first page with more groups, got %+v", firstPage)
+		}
+
+		resp = user.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupIds[0]+"/message", map[string]any{"content": "Moves the group up"})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group?limit=2&before="+firstPage.Cursor.Before)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		nextPage := groupPage{}
+		testutils.UnmarshalJSONResponse(t, resp, &nextPage)
+		if len(nextPage.Groups) != 0 || nextPage.Cursor.HasBefore {
+			t.Errorf("expected the group with the new message to move above the cursor, got %+v", nextPage)
+		}
+
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group?limit=2")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		firstPage = groupPage{}
+		testutils.UnmarshalJSONResponse(t, resp, &firstPage)
+		if len(firstPage.Groups) == 0 || firstPage.Groups[0].Id != groupIds[0] {
+			t.Errorf("expected %q to be the most recently active group, got %+v", groupIds[0], firstPage.Groups)
+		}
+
+		// Members can be filtered by their name or username
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		resp = member.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupIds[0]+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupIds[0]+"/member?limit=1")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		memberData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &memberData)
+		if mems := memberData["members"].([]any); len(mems) != 1 {
+			t.Fatalf("expected 1 member, got %d", len(mems))
+		}
+		if cursor := memberData["cursor"].(map[string]any); cursor["has_before"] != true {
+			t.Errorf("expected has_before to be true, got %v", cursor["has_before"])
+		}
+
+		resp = user.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupIds[0]+"/member?q="+member.Username)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		memberData = map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &memberData)
+		mems := memberData["members"].([]any)
+		if len(mems) != 1 || mems[0].(map[string]any)["usr_id"] != member.UserId {
+			t.Fatalf("expected only the member %q, got %v", member.UserId, mems)
+		}
+	})
+
+	t.Run("TestGroupSystemMessages", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "System Message Group",
+			"description": "Group for testing system messages",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		groupId := createData["id"].(string)
+
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		leaver := testutils.AuthenticatedRequest{}
+		leaver.GetAuth(t, srv)
+		for _, u := range []testutils.AuthenticatedRequest{member, leaver} {
+			resp := u.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+		}
+		resp := req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId, map[string]any{"name": "Renamed Group", "description": "Changed"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		// Updates which do not change the name or the description are not recorded
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId, map[string]any{"name": "Renamed Group"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = leaver.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/member/"+member.UserId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		data := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &data)
+		messages := data["messages"].([]any)
+		// The messages are returned newest first, system messages do not have a sender
+		expected := []struct{ event, actorId string }{
+			{"member_removed", req.UserId},
+			{"member_left", leaver.UserId},
+			{"description_changed", req.UserId},
+			{"group_renamed", req.UserId},
+			{"member_joined", leaver.UserId},
+			{"member_joined", member.UserId},
+		}
+		if len(messages) != len(expected) {
+			t.Fatalf("expected %d system messages, got %v", len(expected), messages)
+		}
+		for i, e := range expected {
+			msg := messages[i].(map[string]any)
+			payload := msg["payload"].(map[string]any)
+			if msg["type"] != "system" || payload["event"] != e.event || payload["actor_id"] != e.actorId || msg["sender_id"] != nil {
+				t.Errorf("expected %s by %s, got %v", e.event, e.actorId, msg)
+			}
+		}
+		if payload := messages[0].(map[string]any)["payload"].(map[string]any); payload["user_id"] != member.UserId {
+			t.Errorf("expected the removed member in the payload, got %v", payload)
+		}
+		if payload := messages[3].(map[string]any)["payload"].(map[string]any); payload["name"] != "Renamed Group" || payload["previous_name"] != "System Message Group" {
+			t.Errorf("unexpected payload of the rename %v", payload)
+		}
+
+		// System messages cannot be sent, edited or deleted by members
+		systemMessageId := messages[3].(map[string]any)["id"].(string)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"type":    "system",
+			"payload": map[string]any{"event": "member_joined"},
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+systemMessageId, map[string]any{"content": "Edited"})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+systemMessageId)
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		// Users who appear in system messages can still be deleted
+		_, err := app.DatabaseService.Pool.Exec(context.Background(), "DELETE FROM usr WHERE id = $1", ulid.MustParse(leaver.UserId).Bytes())
+		if err != nil {
+			t.Fatalf("could not delete user: %v", err)
+		}
+	})
 }
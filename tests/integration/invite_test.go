@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ananthvk/gochat/internal/testutils"
+)
+
+func TestInvite(t *testing.T) {
+	_, srv, _, cancel := testutils.NewTestServerWithDatabaseAndCancel(t)
+	defer srv.Close()
+	defer cancel()
+
+	owner := testutils.AuthenticatedRequest{}
+	owner.GetAuth(t, srv)
+
+	createGroupResp := owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+		"name":        "Invite Test Group",
+		"description": "Group for testing invite links",
+	})
+	testutils.CheckStatusCode(t, createGroupResp, http.StatusCreated)
+
+	createGroupData := map[string]any{}
+	testutils.UnmarshalJSONResponse(t, createGroupResp, &createGroupData)
+	groupId := createGroupData["id"].(string)
+
+	t.Run("TestInviteMaxUses", func(t *testing.T) {
+		resp := owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/invite", map[string]any{
+			"max_uses": 1,
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+
+		invite := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &invite)
+		code := invite["code"].(string)
+
+		first := testutils.AuthenticatedRequest{}
+		first.GetAuth(t, srv)
+		resp = first.MakeAuthenticatedPostRequest(t, srv, "/api/v1/invite/"+code, nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		redeemData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &redeemData)
+		if redeemData["group_id"] != groupId {
+			t.Errorf("expected group_id %q, got %q", groupId, redeemData["group_id"])
+		}
+		resp = first.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// A member cannot manage invites
+		resp = first.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/invite")
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The invite has been used up
+		second := testutils.AuthenticatedRequest{}
+		second.GetAuth(t, srv)
+		resp = second.MakeAuthenticatedPostRequest(t, srv, "/api/v1/invite/"+code, nil)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("TestInviteRevoke", func(t *testing.T) {
+		resp := owner.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/invite", map[string]any{
+			"expires_in": 3600,
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+
+		invite := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &invite)
+
+		resp = owner.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/invite/"+invite["id"].(string))
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		user := testutils.AuthenticatedRequest{}
+		user.GetAuth(t, srv)
+		resp = user.MakeAuthenticatedPostRequest(t, srv, "/api/v1/invite/"+invite["code"].(string), nil)
+		testutils.CheckStatusCode(t, resp, http.StatusNotFound)
+
+		resp = owner.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/invite")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		listData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &listData)
+		if invites, ok := listData["invites"].([]any); !ok || len(invites) < 2 {
+			t.Errorf("expected at least 2 invites, got %v", listData["invites"])
+		}
+	})
+}
@@ -2,8 +2,11 @@ package integration
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ananthvk/gochat/internal/testutils"
 	"github.com/oklog/ulid/v2"
@@ -119,4 +122,942 @@ func TestMessage(t *testing.T) {
 			t.Errorf("expected at least 3 messages, got %d", len(messages))
 		}
 	})
+
+	t.Run("TestMessageUpdatesGroupLastMessage", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{
+			"name":        "Last Message Test Group",
+			"description": "Group for testing the last message of a group",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		lastGroupId := createData["id"].(string)
+
+		messageIds := []string{}
+		for i := 0; i < 2; i++ {
+			resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+lastGroupId+"/message", map[string]any{
+				"content": "Last message test " + string(rune(i+'1')),
+				"type":    "text",
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			msgData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &msgData)
+			messageIds = append(messageIds, msgData["id"].(string))
+		}
+
+		getGroup := func() map[string]any {
+			t.Helper()
+			resp := req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group")
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			respData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &respData)
+			for _, grp := range respData["groups"].([]any) {
+				if grp.(map[string]any)["id"] == lastGroupId {
+					return grp.(map[string]any)
+				}
+			}
+			t.Fatalf("group %q not found in the list of groups", lastGroupId)
+			return nil
+		}
+
+		// The group with the most recent message is listed first
+		resp := req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group?limit=1")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		listData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &listData)
+		if first := listData["groups"].([]any)[0].(map[string]any); first["id"] != lastGroupId {
+			t.Errorf("expected group %q to be listed first, got %q", lastGroupId, first["id"])
+		}
+
+		grp := getGroup()
+		if grp["message_count"] != float64(2) {
+			t.Errorf("expected message count 2, got %v", grp["message_count"])
+		}
+		if lastMessage := grp["last_message"].(map[string]any); lastMessage["id"] != messageIds[1] {
+			t.Errorf("expected last message %q, got %q", messageIds[1], lastMessage["id"])
+		}
+
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+lastGroupId+"/message/"+messageIds[1])
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		grp = getGroup()
+		if grp["message_count"] != float64(1) {
+			t.Errorf("expected message count 1, got %v", grp["message_count"])
+		}
+		if lastMessage := grp["last_message"].(map[string]any); lastMessage["id"] != messageIds[0] {
+			t.Errorf("expected last message %q, got %q", messageIds[0], lastMessage["id"])
+		}
+	})
+
+	t.Run("TestMessageEdit", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "Helo",
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		messageId := createData["id"].(string)
+		if createData["edited_at"] != nil {
+			t.Errorf("expected edited_at to be null for a new message, got %v", createData["edited_at"])
+		}
+
+		// Only the sender can edit the message
+		other := testutils.AuthenticatedRequest{}
+		other.GetAuth(t, srv)
+		resp := other.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = other.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId, map[string]any{"content": "Hijacked"})
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId, map[string]any{"content": "Hello"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		editData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &editData)
+		if editData["content"] != "Hello" {
+			t.Errorf("expected content %q, got %v", "Hello", editData["content"])
+		}
+		if editData["edited_at"] == nil {
+			t.Errorf("expected edited_at to be set after an edit")
+		}
+
+		resp = other.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId+"/revision")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		revisionData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &revisionData)
+		revisions := revisionData["revisions"].([]any)
+		if len(revisions) != 1 || revisions[0].(map[string]any)["content"] != "Helo" {
+			t.Fatalf("expected one revision with the original content, got %v", revisions)
+		}
+	})
+
+	t.Run("TestMessageSoftDeleteAndPurge", func(t *testing.T) {
+		createResp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "This message will be deleted",
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, createResp, http.StatusCreated)
+		createData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, createResp, &createData)
+		messageId := createData["id"].(string)
+
+		findMessage := func() map[string]any {
+			t.Helper()
+			resp := req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message?limit=100")
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			respData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &respData)
+			for _, msg := range respData["messages"].([]any) {
+				if msg.(map[string]any)["id"] == messageId {
+					return msg.(map[string]any)
+				}
+			}
+			return nil
+		}
+
+		resp := req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// The deleted message is listed as a tombstone without its content
+		tombstone := findMessage()
+		if tombstone == nil {
+			t.Fatalf("expected the deleted message to be listed as a tombstone")
+		}
+		if tombstone["content"] != "" || tombstone["deleted_at"] == nil || tombstone["deleted_by"] != req.UserId {
+			t.Errorf("expected a tombstone deleted by %q, got %v", req.UserId, tombstone)
+		}
+
+		// Only the owner and admins can purge messages
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		resp = member.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = member.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId+"/purge")
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId+"/purge")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		if findMessage() != nil {
+			t.Errorf("expected the purged message to be removed")
+		}
+	})
+
+	t.Run("TestMessageDeletePermissions", func(t *testing.T) {
+		sender := testutils.AuthenticatedRequest{}
+		sender.GetAuth(t, srv)
+		other := testutils.AuthenticatedRequest{}
+		other.GetAuth(t, srv)
+		for _, u := range []testutils.AuthenticatedRequest{sender, other} {
+			resp := u.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+		}
+
+		messageIds := []string{}
+		for i := 0; i < 2; i++ {
+			resp := sender.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+				"content": "Moderation test message " + string(rune(i+'1')),
+				"type":    "text",
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			msgData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &msgData)
+			messageIds = append(messageIds, msgData["id"].(string))
+		}
+
+		// Other members cannot delete the message
+		resp := other.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[0])
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+
+		// The sender and the owner of the group can delete the message
+		resp = sender.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[0])
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[1])
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// Only the deletion by the owner is a moderation action
+		resp = other.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/moderation-log")
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/moderation-log")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		logData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &logData)
+		found := false
+		for _, entry := range logData["entries"].([]any) {
+			e := entry.(map[string]any)
+			if e["message_id"] == messageIds[0] {
+				t.Errorf("expected deletion by the sender to not be logged")
+			}
+			if e["message_id"] == messageIds[1] {
+				found = true
+				if e["action"] != "message_deleted" || e["actor_id"] != req.UserId || e["target_usr_id"] != sender.UserId {
+					t.Errorf("unexpected moderation log entry %v", e)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected the deletion by the owner to be logged")
+		}
+	})
+
+	t.Run("TestMessageReply", func(t *testing.T) {
+		resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "Parent message",
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		parentData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &parentData)
+		parentId := parentData["id"].(string)
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content":     "Reply message",
+			"type":        "text",
+			"reply_to_id": parentId,
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		replyData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &replyData)
+		if replyData["reply_to_id"] != parentId {
+			t.Errorf("expected reply_to_id %q, got %v", parentId, replyData["reply_to_id"])
+		}
+		preview, ok := replyData["reply_to"].(map[string]any)
+		if !ok {
+			t.Fatalf("expected a preview of the parent, got %v", replyData["reply_to"])
+		}
+		if preview["content"] != "Parent message" || preview["sender_id"] != req.UserId || preview["deleted"] != false {
+			t.Errorf("unexpected preview %v", preview)
+		}
+
+		// The parent must belong to the same group
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{"name": "Another group"})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		otherGroupData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &otherGroupData)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+otherGroupData["id"].(string)+"/message", map[string]any{
+			"content":     "Reply from another group",
+			"type":        "text",
+			"reply_to_id": parentId,
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		// Deleting the parent is reflected in the preview
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+parentId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+replyData["id"].(string))
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		replyData = map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &replyData)
+		preview = replyData["reply_to"].(map[string]any)
+		if preview["content"] != "" || preview["deleted"] != true {
+			t.Errorf("expected the preview of a deleted parent, got %v", preview)
+		}
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content":     "Reply to a deleted message",
+			"type":        "text",
+			"reply_to_id": parentId,
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("TestMessageReactions", func(t *testing.T) {
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		resp := member.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "React to this message",
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		msgData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		reactionUrl := "/api/v1/group/" + groupId + "/message/" + msgData["id"].(string) + "/reaction/"
+
+		// Reacting twice with the same emoji counts once
+		for _, u := range []testutils.AuthenticatedRequest{req, req, member} {
+			resp = u.MakeAuthenticatedPutRequest(t, srv, reactionUrl+"👍", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+		}
+		resp = member.MakeAuthenticatedPutRequest(t, srv, reactionUrl+"🎉", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		reactionsOf := func(u testutils.AuthenticatedRequest) map[string]map[string]any {
+			resp := u.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message?limit=1")
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			reactions := map[string]map[string]any{}
+			for _, reaction := range data["messages"].([]any)[0].(map[string]any)["reactions"].([]any) {
+				r := reaction.(map[string]any)
+				reactions[r["emoji"].(string)] = r
+			}
+			return reactions
+		}
+		reactions := reactionsOf(req)
+		if len(reactions) != 2 || reactions["👍"]["count"] != float64(2) || reactions["👍"]["reacted"] != true {
+			t.Errorf("unexpected reactions %v", reactions)
+		}
+		if reactions["🎉"]["count"] != float64(1) || reactions["🎉"]["reacted"] != false {
+			t.Errorf("unexpected reactions %v", reactions)
+		}
+
+		resp = req.MakeAuthenticatedGetRequest(t, srv, reactionUrl[:len(reactionUrl)-1])
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		listData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &listData)
+		if len(listData["reactions"].([]any)) != 3 {
+			t.Errorf("expected 3 reactions, got %v", listData["reactions"])
+		}
+
+		resp = member.MakeAuthenticatedDeleteRequest(t, srv, reactionUrl+"🎉")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		reactions = reactionsOf(member)
+		if len(reactions) != 1 || reactions["👍"]["count"] != float64(2) || reactions["👍"]["reacted"] != true {
+			t.Errorf("unexpected reactions %v", reactions)
+		}
+	})
+
+	t.Run("TestMessageThread", func(t *testing.T) {
+		resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "Thread root",
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		rootData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &rootData)
+		rootId := rootData["id"].(string)
+
+		replyIds := []string{}
+		for i := 0; i < 3; i++ {
+			resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+				"content":        "Thread reply " + string(rune(i+'1')),
+				"type":           "text",
+				"thread_root_id": rootId,
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			replyData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &replyData)
+			if replyData["thread_root_id"] != rootId {
+				t.Errorf("expected thread_root_id %q, got %v", rootId, replyData["thread_root_id"])
+			}
+			replyIds = append(replyIds, replyData["id"].(string))
+		}
+
+		// Threads cannot be nested
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content":        "Nested reply",
+			"type":           "text",
+			"thread_root_id": replyIds[0],
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		// Replies are not part of the timeline, the root keeps the reply count
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message?limit=1")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		timeline := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &timeline)
+		latest := timeline["messages"].([]any)[0].(map[string]any)
+		if latest["id"] != rootId || latest["reply_count"] != float64(3) || latest["last_reply_at"] == nil {
+			t.Errorf("expected the thread root with 3 replies to be the latest message, got %v", latest)
+		}
+
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+rootId+"/thread?limit=2")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		thread := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &thread)
+		messages := thread["messages"].([]any)
+		cursor := thread["cursor"].(map[string]any)
+		if len(messages) != 2 || messages[0].(map[string]any)["id"] != replyIds[2] || cursor["has_before"] != true {
+			t.Errorf("unexpected thread page %v", thread)
+		}
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+rootId+"/thread?limit=2&before="+cursor["before"].(string))
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		thread = map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &thread)
+		messages = thread["messages"].([]any)
+		if len(messages) != 1 || messages[0].(map[string]any)["id"] != replyIds[0] || thread["cursor"].(map[string]any)["has_before"] != false {
+			t.Errorf("unexpected thread page %v", thread)
+		}
+
+		// Deleting a reply updates the reply count of the root
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+replyIds[2])
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+rootId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		rootData = map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &rootData)
+		if rootData["reply_count"] != float64(2) {
+			t.Errorf("expected 2 replies, got %v", rootData["reply_count"])
+		}
+	})
+
+	t.Run("TestMessageStatus", func(t *testing.T) {
+		reader := testutils.AuthenticatedRequest{}
+		reader.GetAuth(t, srv)
+		resp := reader.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		messageIds := []string{}
+		for i := 0; i < 3; i++ {
+			resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+				"content": "Status test message " + string(rune(i+'1')),
+				"type":    "text",
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			msgData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &msgData)
+			messageIds = append(messageIds, msgData["id"].(string))
+		}
+
+		statusOf := func(messageId string) string {
+			resp := req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			for _, status := range data["statuses"].([]any) {
+				s := status.(map[string]any)
+				if s["user_id"] == reader.UserId {
+					return s["status"].(string)
+				}
+			}
+			return ""
+		}
+
+		resp = reader.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[2]+"/delivered", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		resp = reader.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[1]+"/read", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		if status := statusOf(messageIds[0]); status != "read" {
+			t.Errorf("expected read, got %q", status)
+		}
+		if status := statusOf(messageIds[1]); status != "read" {
+			t.Errorf("expected read, got %q", status)
+		}
+		if status := statusOf(messageIds[2]); status != "delivered" {
+			t.Errorf("expected delivered, got %q", status)
+		}
+
+		// A read message is not marked as delivered again
+		resp = reader.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[2]+"/delivered", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		markData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &markData)
+		if markData["marked"] != float64(0) {
+			t.Errorf("expected no messages to be marked, got %v", markData["marked"])
+		}
+		if status := statusOf(messageIds[1]); status != "read" {
+			t.Errorf("expected read, got %q", status)
+		}
+	})
+
+	t.Run("TestMessageUnreadCount", func(t *testing.T) {
+		// The read marker of a new member starts at the last message sent before they joined
+		resp := req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+groupId+"/message?limit=1")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		lastData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &lastData)
+		lastMessageId := lastData["messages"].([]any)[0].(map[string]any)["id"]
+
+		reader := testutils.AuthenticatedRequest{}
+		reader.GetAuth(t, srv)
+		resp = reader.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		// Messages sent before the user joined, and by the user themselves are not unread
+		resp = reader.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "Own message",
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		messageIds := []string{}
+		for i := 0; i < 3; i++ {
+			resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+				"content": "Unread message " + string(rune(i+'1')),
+				"type":    "text",
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			msgData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &msgData)
+			messageIds = append(messageIds, msgData["id"].(string))
+		}
+
+		unread := func() map[string]any {
+			resp := reader.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group")
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			for _, grp := range data["groups"].([]any) {
+				g := grp.(map[string]any)
+				if g["id"] == groupId {
+					return g
+				}
+			}
+			t.Fatalf("group %q not found", groupId)
+			return nil
+		}
+		grp := unread()
+		if grp["unread_count"] != float64(3) || grp["first_unread_id"] != messageIds[0] || grp["last_read_message_id"] != lastMessageId {
+			t.Errorf("unexpected unread state %v", grp)
+		}
+
+		resp = reader.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[1]+"/read", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		grp = unread()
+		if grp["unread_count"] != float64(1) || grp["first_unread_id"] != messageIds[2] || grp["last_read_message_id"] != messageIds[1] {
+			t.Errorf("unexpected unread state %v", grp)
+		}
+
+		// Deleting an unread message removes it from the unread count
+		resp = req.MakeAuthenticatedDeleteRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[2])
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		grp = unread()
+		if grp["unread_count"] != float64(0) || grp["first_unread_id"] != nil {
+			t.Errorf("unexpected unread state %v", grp)
+		}
+
+		// The read marker never moves backward
+		resp = reader.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageIds[0]+"/read", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		grp = unread()
+		if grp["last_read_message_id"] != messageIds[1] {
+			t.Errorf("expected the read marker to stay at %q, got %v", messageIds[1], grp["last_read_message_id"])
+		}
+	})
+
+	t.Run("TestMessageForwardPagination", func(t *testing.T) {
+		resp := req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{"name": "Pagination group"})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		grpData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &grpData)
+		messagesUrl := "/api/v1/group/" + grpData["id"].(string) + "/message"
+
+		messageIds := []string{}
+		for i := 0; i < 7; i++ {
+			resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{
+				"content": "Message " + string(rune(i+'0')),
+				"type":    "text",
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			msgData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &msgData)
+			messageIds = append(messageIds, msgData["id"].(string))
+		}
+
+		page := func(query string) ([]string, map[string]any) {
+			resp := req.MakeAuthenticatedGetRequest(t, srv, messagesUrl+"?"+query)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			ids := []string{}
+			for _, message := range data["messages"].([]any) {
+				ids = append(ids, message.(map[string]any)["id"].(string))
+			}
+			return ids, data["cursor"].(map[string]any)
+		}
+		expectPage := func(query string, expected []string, hasBefore, hasAfter bool) {
+			ids, cursor := page(query)
+			if fmt.Sprint(ids) != fmt.Sprint(expected) {
+				t.Errorf("%s: expected %v, got %v", query, expected, ids)
+			}
+			if cursor["has_before"] != hasBefore || cursor["has_after"] != hasAfter {
+				t.Errorf("%s: unexpected cursor %v", query, cursor)
+			}
+		}
+
+		expectPage("limit=2", []string{messageIds[6], messageIds[5]}, true, false)
+		expectPage("limit=2&before="+messageIds[5], []string{messageIds[4], messageIds[3]}, true, true)
+		expectPage("limit=2&after="+messageIds[1], []string{messageIds[3], messageIds[2]}, true, true)
+		expectPage("limit=2&after="+messageIds[4], []string{messageIds[6], messageIds[5]}, true, false)
+		expectPage("limit=2&around="+messageIds[3], []string{messageIds[5], messageIds[4], messageIds[3], messageIds[2], messageIds[1]}, true, true)
+		expectPage("limit=3&around="+messageIds[1], []string{messageIds[4], messageIds[3], messageIds[2], messageIds[1], messageIds[0]}, false, true)
+
+		resp = req.MakeAuthenticatedGetRequest(t, srv, messagesUrl+"?before="+messageIds[1]+"&after="+messageIds[0])
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		for _, limit := range []string{"0", "101", "99999", "2147483647", "ten"} {
+			resp = req.MakeAuthenticatedGetRequest(t, srv, messagesUrl+"?limit="+limit)
+			testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("TestMessageSearch", func(t *testing.T) {
+		createGroup := func(u testutils.AuthenticatedRequest, name string) string {
+			resp := u.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group", map[string]any{"name": name})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			grpData := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &grpData)
+			return grpData["id"].(string)
+		}
+		send := func(u testutils.AuthenticatedRequest, grpId, content string) {
+			resp := u.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+grpId+"/message", map[string]any{
+				"content": content,
+				"type":    "text",
+			})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		}
+		search := func(u testutils.AuthenticatedRequest, path string) ([]map[string]any, map[string]any) {
+			resp := u.MakeAuthenticatedGetRequest(t, srv, path)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			results := []map[string]any{}
+			for _, result := range data["results"].([]any) {
+				results = append(results, result.(map[string]any))
+			}
+			return results, data["cursor"].(map[string]any)
+		}
+
+		outsider := testutils.AuthenticatedRequest{}
+		outsider.GetAuth(t, srv)
+		first := createGroup(req, "Search group one")
+		second := createGroup(req, "Search group two")
+		hidden := createGroup(outsider, "Search group hidden")
+		send(req, first, "We decided to ship the zeppelins on friday")
+		send(req, first, "Nothing to see here")
+		send(req, second, "The zeppelin launch was postponed")
+		send(outsider, hidden, "A zeppelin that nobody else should find")
+		send(req, second, "<script>alert('blimp')</script>")
+
+		// The content is escaped, so that the snippet can be rendered as HTML
+		results, _ := search(req, "/api/v1/search?q=blimp")
+		if len(results) != 1 || strings.Contains(results[0]["snippet"].(string), "<script>") {
+			t.Fatalf("expected an escaped snippet, got %v", results)
+		}
+		if !strings.Contains(results[0]["snippet"].(string), "&lt;script&gt;") {
+			t.Errorf("unexpected snippet %v", results[0]["snippet"])
+		}
+
+		// The global search only covers the groups of the user
+		results, _ = search(req, "/api/v1/search?q=zeppelin")
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(results))
+		}
+		if results[0]["group_id"] != second || results[1]["group_id"] != first {
+			t.Errorf("expected the results to be newest first, got %v", results)
+		}
+		if !strings.Contains(results[1]["snippet"].(string), "<mark>zeppelins</mark>") {
+			t.Errorf("unexpected snippet %v", results[1]["snippet"])
+		}
+		if results[0]["group_name"] != "Search group two" {
+			t.Errorf("unexpected group name %v", results[0]["group_name"])
+		}
+
+		results, cursor := search(req, "/api/v1/search?q=zeppelin&limit=1")
+		if len(results) != 1 || cursor["has_before"] != true {
+			t.Fatalf("expected a page with more results, got %v %v", results, cursor)
+		}
+		results, cursor = search(req, "/api/v1/search?q=zeppelin&limit=1&before="+cursor["before"].(string))
+		if len(results) != 1 || results[0]["group_id"] != first || cursor["has_before"] != false {
+			t.Errorf("unexpected last page %v %v", results, cursor)
+		}
+
+		results, _ = search(req, "/api/v1/group/"+first+"/message/search?q=zeppelin")
+		if len(results) != 1 || results[0]["group_id"] != first {
+			t.Errorf("expected 1 result in the group, got %v", results)
+		}
+		results, _ = search(req, "/api/v1/search?q=zeppelin&sender="+outsider.UserId)
+		if len(results) != 0 {
+			t.Errorf("expected no results from the outsider, got %v", results)
+		}
+		results, _ = search(req, "/api/v1/search?q=zeppelin&since=2000-01-01T00:00:00Z&until=2001-01-01T00:00:00Z")
+		if len(results) != 0 {
+			t.Errorf("expected no results in the date range, got %v", results)
+		}
+
+		resp := outsider.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group/"+first+"/message/search?q=zeppelin")
+		testutils.CheckStatusCode(t, resp, http.StatusForbidden)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/search")
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/search?q=zeppelin&since=yesterday")
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/search?q=zeppelin&limit=99999")
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/search?q=zeppelin&type=sticker")
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		results, _ = search(req, "/api/v1/search?q=zeppelin&type=poll")
+		if len(results) != 0 {
+			t.Errorf("expected no polls in the results, got %v", results)
+		}
+	})
+
+	t.Run("TestMessageMentions", func(t *testing.T) {
+		member := testutils.AuthenticatedRequest{}
+		member.GetAuth(t, srv)
+		outsider := testutils.AuthenticatedRequest{}
+		outsider.GetAuth(t, srv)
+		resp := member.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+
+		content := "Hey @" + member.Username + ", @" + outsider.Username + " and @" + req.Username + " see this"
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": content,
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		msgData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		messageId := msgData["id"].(string)
+
+		// Only the members of the group are mentioned
+		entities := msgData["entities"].([]any)
+		if len(entities) != 2 {
+			t.Fatalf("expected 2 mentions, got %v", entities)
+		}
+		entity := entities[0].(map[string]any)
+		if entity["type"] != "mention" || entity["user_id"] != member.UserId || entity["username"] != member.Username {
+			t.Errorf("unexpected mention %v", entity)
+		}
+		if entity["offset"] != float64(4) || entity["length"] != float64(len(member.Username)+1) {
+			t.Errorf("unexpected span of the mention %v", entity)
+		}
+		if entities[1].(map[string]any)["user_id"] != req.UserId {
+			t.Errorf("expected the sender to be mentioned, got %v", entities[1])
+		}
+
+		mentionsOf := func(u testutils.AuthenticatedRequest) []string {
+			resp := u.MakeAuthenticatedGetRequest(t, srv, "/api/v1/me/mentions")
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			ids := []string{}
+			for _, message := range data["messages"].([]any) {
+				ids = append(ids, message.(map[string]any)["id"].(string))
+			}
+			return ids
+		}
+		if ids := mentionsOf(member); len(ids) != 1 || ids[0] != messageId {
+			t.Errorf("expected the message in the mentions of the member, got %v", ids)
+		}
+		// Mentions of the sender themselves are not part of the feed
+		for _, id := range mentionsOf(req) {
+			if id == messageId {
+				t.Errorf("expected the message to not be in the mentions of the sender")
+			}
+		}
+		if ids := mentionsOf(outsider); len(ids) != 0 {
+			t.Errorf("expected no mentions of the outsider, got %v", ids)
+		}
+
+		// The mentions are parsed again when the message is edited
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, "/api/v1/group/"+groupId+"/message/"+messageId, map[string]any{"content": "Never mind"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		if entities := msgData["entities"].([]any); len(entities) != 0 {
+			t.Errorf("expected no mentions after the edit, got %v", entities)
+		}
+		if ids := mentionsOf(member); len(ids) != 0 {
+			t.Errorf("expected no mentions of the member after the edit, got %v", ids)
+		}
+
+		// Members whose names look like the username do not crowd out the mentioned member
+		for i := 0; i < 11; i++ {
+			other := testutils.AuthenticatedRequest{}
+			other.GetAuth(t, srv)
+			resp = other.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+			testutils.CheckStatusCode(t, resp, http.StatusOK)
+			_, err := app.DatabaseService.Pool.Exec(context.Background(), "UPDATE usr SET name = $1 WHERE id = $2", strings.ToUpper(member.Username), ulid.MustParse(other.UserId).Bytes())
+			if err != nil {
+				t.Fatalf("could not rename user: %v", err)
+			}
+		}
+		resp = req.MakeAuthenticatedPostRequest(t, srv, "/api/v1/group/"+groupId+"/message", map[string]any{
+			"content": "Hey @" + member.Username,
+			"type":    "text",
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		if entities := msgData["entities"].([]any); len(entities) != 1 || entities[0].(map[string]any)["user_id"] != member.UserId {
+			t.Errorf("expected the member to be mentioned, got %v", entities)
+		}
+	})
+
+	t.Run("TestMessagePayload", func(t *testing.T) {
+		messagesUrl := "/api/v1/group/" + groupId + "/message"
+		resp := req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{
+			"type":    "text",
+			"payload": map[string]any{"content": "Sent with a payload"},
+		})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		msgData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		if msgData["content"] != "Sent with a payload" || msgData["payload"].(map[string]any)["content"] != "Sent with a payload" {
+			t.Errorf("unexpected message %v", msgData)
+		}
+		messageId := msgData["id"].(string)
+
+		// The payload is validated by its type
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "text", "payload": map[string]any{}})
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "text", "payload": map[string]any{"content": "Hi", "extra": 1}})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "text", "content": "Hi", "payload": map[string]any{"content": "Hi"}})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "unknown", "payload": map[string]any{"content": "Hi"}})
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+
+		// Edits update the payload, and the group list shows the preview of the last message
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, messagesUrl+"/"+messageId, map[string]any{"content": "Edited payload"})
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		if msgData["payload"].(map[string]any)["content"] != "Edited payload" {
+			t.Errorf("expected the payload to be edited, got %v", msgData["payload"])
+		}
+		resp = req.MakeAuthenticatedGetRequest(t, srv, "/api/v1/group")
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		grpData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &grpData)
+		for _, grp := range grpData["groups"].([]any) {
+			if grp.(map[string]any)["id"] != groupId {
+				continue
+			}
+			lastMessage := grp.(map[string]any)["last_message"].(map[string]any)
+			if lastMessage["id"] != messageId || lastMessage["preview"] != "Edited payload" {
+				t.Errorf("unexpected last message %v", lastMessage)
+			}
+		}
+	})
+
+	t.Run("TestMessagePolls", func(t *testing.T) {
+		voter := testutils.AuthenticatedRequest{}
+		voter.GetAuth(t, srv)
+		resp := voter.MakeAuthenticatedPutRequest(t, srv, "/api/v1/group/"+groupId+"/member", nil)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		messagesUrl := "/api/v1/group/" + groupId + "/message"
+
+		createPoll := func(poll map[string]any) string {
+			t.Helper()
+			resp := req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "poll", "payload": poll})
+			testutils.CheckStatusCode(t, resp, http.StatusCreated)
+			data := map[string]any{}
+			testutils.UnmarshalJSONResponse(t, resp, &data)
+			return data["id"].(string)
+		}
+		vote := func(u testutils.AuthenticatedRequest, pollId string, options []int, status int) map[string]any {
+			t.Helper()
+			resp := u.MakeAuthenticatedPostRequest(t, srv, messagesUrl+"/"+pollId+"/vote", map[string]any{"options": options})
+			testutils.CheckStatusCode(t, resp, status)
+			data := map[string]any{}
+			if status == http.StatusOK {
+				testutils.UnmarshalJSONResponse(t, resp, &data)
+			}
+			return data
+		}
+		votesOf := func(poll map[string]any) []float64 {
+			counts := []float64{}
+			for _, option := range poll["options"].([]any) {
+				counts = append(counts, option.(map[string]any)["votes"].(float64))
+			}
+			return counts
+		}
+
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "poll", "payload": map[string]any{"question": "Lunch?", "options": []string{"Pizza"}}})
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "poll", "payload": map[string]any{
+			"question":  "Lunch?",
+			"options":   []string{"Pizza", "Salad"},
+			"closes_at": time.Now().Add(-time.Hour),
+		}})
+		testutils.CheckStatusCode(t, resp, http.StatusUnprocessableEntity)
+
+		pollId := createPoll(map[string]any{"question": "Lunch?", "options": []string{"Pizza", "Salad", "Soup"}})
+		vote(voter, pollId, []int{0, 1}, http.StatusBadRequest)
+		vote(voter, pollId, []int{3}, http.StatusBadRequest)
+		poll := vote(voter, pollId, []int{1}, http.StatusOK)
+		if counts := votesOf(poll); counts[0] != 0 || counts[1] != 1 || poll["total_voters"] != float64(1) {
+			t.Errorf("unexpected results %v", poll)
+		}
+		// Voting again replaces the vote
+		vote(voter, pollId, []int{2}, http.StatusOK)
+		vote(req, pollId, []int{2}, http.StatusOK)
+
+		// The vote of the current user is included in the message
+		resp = voter.MakeAuthenticatedGetRequest(t, srv, messagesUrl+"/"+pollId)
+		testutils.CheckStatusCode(t, resp, http.StatusOK)
+		msgData := map[string]any{}
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		poll = msgData["poll"].(map[string]any)
+		if counts := votesOf(poll); counts[1] != 0 || counts[2] != 2 || poll["total_voters"] != float64(2) {
+			t.Errorf("unexpected results %v", poll)
+		}
+		if v := poll["vote"].([]any); len(v) != 1 || v[0] != float64(2) {
+			t.Errorf("expected the vote of the user, got %v", poll["vote"])
+		}
+		if voters := poll["options"].([]any)[2].(map[string]any)["voter_ids"].([]any); len(voters) != 2 {
+			t.Errorf("expected the voters of the option, got %v", voters)
+		}
+
+		// Polls cannot be edited, even if the content is unchanged
+		resp = req.MakeAuthenticatedPatchRequest(t, srv, messagesUrl+"/"+pollId, map[string]any{"content": msgData["content"]})
+		testutils.CheckStatusCode(t, resp, http.StatusBadRequest)
+
+		// The vote can be retracted
+		poll = vote(voter, pollId, []int{}, http.StatusOK)
+		if v := poll["vote"].([]any); len(v) != 0 || poll["total_voters"] != float64(1) {
+			t.Errorf("expected the vote to be retracted, got %v", poll)
+		}
+
+		anonymousId := createPoll(map[string]any{
+			"question":        "Which days?",
+			"options":         []string{"Monday", "Tuesday", "Wednesday"},
+			"multiple_choice": true,
+			"anonymous":       true,
+			"closes_at":       time.Now().Add(time.Hour),
+		})
+		poll = vote(voter, anonymousId, []int{0, 2}, http.StatusOK)
+		if counts := votesOf(poll); counts[0] != 1 || counts[1] != 0 || counts[2] != 1 || poll["total_voters"] != float64(1) {
+			t.Errorf("unexpected results %v", poll)
+		}
+		for _, option := range poll["options"].([]any) {
+			if option.(map[string]any)["voter_ids"] != nil {
+				t.Errorf("expected the voters of an anonymous poll to be hidden, got %v", option)
+			}
+		}
+
+		// Only polls can be voted on
+		resp = req.MakeAuthenticatedPostRequest(t, srv, messagesUrl, map[string]any{"type": "text", "content": "Not a poll"})
+		testutils.CheckStatusCode(t, resp, http.StatusCreated)
+		testutils.UnmarshalJSONResponse(t, resp, &msgData)
+		vote(voter, msgData["id"].(string), []int{0}, http.StatusBadRequest)
+	})
 }